@@ -46,15 +46,25 @@ function LibrarianPage({ reservations, onReturn }: Props) {
         const color =
           status === "RENTED"
             ? "orange"
-            : status === "RETURNED"
-              ? "green"
-              : "blue";
+            : status === "OVERDUE"
+              ? "red"
+              : status === "RETURNED" || status === "RETURNED_LATE"
+                ? "green"
+                : status === "LOST"
+                  ? "volcano"
+                  : "blue";
         const label =
           status === "RENTED"
             ? "Забронирована"
-            : status === "RETURNED"
-              ? "Возвращена"
-              : "Выдана";
+            : status === "OVERDUE"
+              ? "Просрочена"
+              : status === "RETURNED"
+                ? "Возвращена"
+                : status === "RETURNED_LATE"
+                  ? "Возвращена с опозданием"
+                  : status === "LOST"
+                    ? "Утеряна"
+                    : "Выдана";
         return <Tag color={color}>{label}</Tag>;
       },
     },
@@ -62,7 +72,7 @@ function LibrarianPage({ reservations, onReturn }: Props) {
       title: "Действие",
       key: "action",
       render: (_: unknown, record: Reservation) =>
-        record.status !== "RETURNED" ? (
+        record.status === "RENTED" || record.status === "OVERDUE" ? (
           <Space>
             <Button
               onClick={() => {
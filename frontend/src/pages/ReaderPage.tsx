@@ -18,8 +18,14 @@ function ReaderPage({ currentUser, reservations }: Props) {
       dataIndex: "status",
       key: "status",
       render: (status: string) => {
-        const color = status === "RENTED" ? "orange" : "blue";
-        const label = status === "RENTED" ? "Забронирована" : "Выдана";
+        const color =
+          status === "RENTED" ? "orange" : status === "OVERDUE" ? "red" : "blue";
+        const label =
+          status === "RENTED"
+            ? "Забронирована"
+            : status === "OVERDUE"
+              ? "Просрочена"
+              : "Выдана";
         return <Tag color={color}>{label}</Tag>;
       },
     },
@@ -14,6 +14,12 @@ GRANT ALL PRIVILEGES ON DATABASE ratings TO program;
 CREATE DATABASE idp;
 GRANT ALL PRIVILEGES ON DATABASE idp TO program;
 
+CREATE DATABASE gateway;
+GRANT ALL PRIVILEGES ON DATABASE gateway TO program;
+
+CREATE DATABASE statistics;
+GRANT ALL PRIVILEGES ON DATABASE statistics TO program;
+
 
 \c reservations;
 
@@ -25,16 +31,98 @@ CREATE TABLE reservation
     book_uid        uuid        NOT NULL,
     library_uid     uuid        NOT NULL,
     status          VARCHAR(20) NOT NULL
-        CHECK (status IN ('RENTED', 'RETURNED', 'EXPIRED')),
+        CHECK (status IN ('PENDING', 'RENTED', 'OVERDUE', 'RETURNED', 'RETURNED_LATE', 'CANCELLED', 'LOST')),
     start_date      TIMESTAMP   NOT NULL,
-    till_date       TIMESTAMP   NOT NULL
+    till_date       TIMESTAMP   NOT NULL,
+    checkout_condition VARCHAR(20)
+        CHECK (checkout_condition IN ('EXCELLENT', 'GOOD', 'BAD'))
+);
+
+CREATE INDEX reservation_overdue_idx ON reservation (status, till_date);
+
+CREATE TABLE reservation_status_history
+(
+    id              SERIAL PRIMARY KEY,
+    reservation_uid uuid        NOT NULL REFERENCES reservation (reservation_uid),
+    from_status     VARCHAR(20),
+    to_status       VARCHAR(20) NOT NULL,
+    changed_at      TIMESTAMP   NOT NULL
+);
+
+CREATE INDEX reservation_status_history_idx ON reservation_status_history (reservation_uid);
+
+CREATE TABLE renewal
+(
+    id              SERIAL PRIMARY KEY,
+    reservation_uid uuid      NOT NULL REFERENCES reservation (reservation_uid),
+    old_till_date   TIMESTAMP NOT NULL,
+    new_till_date   TIMESTAMP NOT NULL,
+    renewed_at      TIMESTAMP NOT NULL
+);
+
+CREATE INDEX renewal_reservation_idx ON renewal (reservation_uid);
+
+CREATE TABLE hold
+(
+    id          SERIAL PRIMARY KEY,
+    hold_uid    uuid UNIQUE NOT NULL,
+    username    VARCHAR(80) NOT NULL,
+    book_uid    uuid        NOT NULL,
+    library_uid uuid        NOT NULL,
+    status      VARCHAR(20) NOT NULL
+        CHECK (status IN ('WAITING', 'READY_FOR_PICKUP', 'FULFILLED', 'EXPIRED', 'CANCELLED')),
+    created_at  TIMESTAMP   NOT NULL,
+    ready_at    TIMESTAMP,
+    expires_at  TIMESTAMP
 );
 
+CREATE UNIQUE INDEX hold_active_idx ON hold (username, library_uid, book_uid)
+    WHERE status IN ('WAITING', 'READY_FOR_PICKUP');
+CREATE INDEX hold_queue_idx ON hold (library_uid, book_uid, id) WHERE status = 'WAITING';
+CREATE INDEX hold_expiry_idx ON hold (expires_at) WHERE status = 'READY_FOR_PICKUP';
+
+CREATE TABLE consumed_events
+(
+    event_id    uuid PRIMARY KEY,
+    consumed_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE fine
+(
+    id              SERIAL PRIMARY KEY,
+    entry_uid       uuid UNIQUE  NOT NULL,
+    username        VARCHAR(80)  NOT NULL,
+    reservation_uid uuid REFERENCES reservation (reservation_uid),
+    kind            VARCHAR(20)  NOT NULL
+        CHECK (kind IN ('OVERDUE', 'DAMAGE', 'PAYMENT', 'WAIVER')),
+    amount          INTEGER      NOT NULL,
+    note            VARCHAR(255) NOT NULL DEFAULT '',
+    created_by      VARCHAR(80)  NOT NULL,
+    created_at      TIMESTAMP    NOT NULL
+);
+
+CREATE INDEX fine_username_idx ON fine (username, created_at);
+
+CREATE TABLE outbox
+(
+    id         BIGSERIAL PRIMARY KEY,
+    event_id   uuid UNIQUE  NOT NULL,
+    topic      VARCHAR(80)  NOT NULL,
+    key        VARCHAR(255) NOT NULL,
+    payload    JSONB        NOT NULL,
+    created_at TIMESTAMP    NOT NULL,
+    sent_at    TIMESTAMP
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (id) WHERE sent_at IS NULL;
+
 GRANT ALL ON ALL TABLES IN SCHEMA public TO program;
 GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO program;
 
 \c libraries;
 
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
 CREATE TABLE library
 (
     id          SERIAL PRIMARY KEY,
@@ -52,16 +140,48 @@ CREATE TABLE books
     author    VARCHAR(255),
     genre     VARCHAR(255),
     condition VARCHAR(20) DEFAULT 'EXCELLENT'
-        CHECK (condition IN ('EXCELLENT', 'GOOD', 'BAD'))
+        CHECK (condition IN ('EXCELLENT', 'GOOD', 'BAD')),
+    search_vector tsvector GENERATED ALWAYS AS
+        (to_tsvector('russian', name || ' ' || COALESCE(author, ''))) STORED
 );
 
+CREATE INDEX books_search_vector_idx ON books USING GIN (search_vector);
+CREATE INDEX books_name_trgm_idx ON books USING GIN (name gin_trgm_ops);
+CREATE INDEX books_author_trgm_idx ON books USING GIN (author gin_trgm_ops);
+
 CREATE TABLE library_books
 (
     book_id         INT REFERENCES books (id),
     library_id      INT REFERENCES library (id),
     available_count INT NOT NULL
+        CHECK (available_count >= 0),
+    UNIQUE (book_id, library_id)
+);
+
+CREATE TABLE stock_operations
+(
+    operation_key VARCHAR(255) PRIMARY KEY,
+    library_uid   uuid         NOT NULL,
+    book_uid      uuid         NOT NULL,
+    delta         INT          NOT NULL,
+    created_at    TIMESTAMP    NOT NULL
+);
+
+CREATE INDEX stock_operations_created_at_idx ON stock_operations (created_at);
+
+CREATE TABLE outbox
+(
+    id         BIGSERIAL PRIMARY KEY,
+    event_id   uuid UNIQUE  NOT NULL,
+    topic      VARCHAR(80)  NOT NULL,
+    key        VARCHAR(255) NOT NULL,
+    payload    JSONB        NOT NULL,
+    created_at TIMESTAMP    NOT NULL,
+    sent_at    TIMESTAMP
 );
 
+CREATE INDEX outbox_pending_idx ON outbox (id) WHERE sent_at IS NULL;
+
 GRANT ALL ON ALL TABLES IN SCHEMA public TO program;
 GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO program;
 
@@ -97,6 +217,29 @@ CREATE TABLE rating
         CHECK (stars BETWEEN 0 AND 100)
 );
 
+CREATE TABLE rating_operations
+(
+    operation_key VARCHAR(255) PRIMARY KEY,
+    username      VARCHAR(80)  NOT NULL,
+    delta         INT          NOT NULL,
+    created_at    TIMESTAMP    NOT NULL
+);
+
+CREATE INDEX rating_operations_created_at_idx ON rating_operations (created_at);
+
+CREATE TABLE outbox
+(
+    id         BIGSERIAL PRIMARY KEY,
+    event_id   uuid UNIQUE  NOT NULL,
+    topic      VARCHAR(80)  NOT NULL,
+    key        VARCHAR(255) NOT NULL,
+    payload    JSONB        NOT NULL,
+    created_at TIMESTAMP    NOT NULL,
+    sent_at    TIMESTAMP
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (id) WHERE sent_at IS NULL;
+
 GRANT ALL ON ALL TABLES IN SCHEMA public TO program;
 GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO program;
 
@@ -144,4 +287,69 @@ GRANT ALL ON ALL TABLES IN SCHEMA public TO program;
 GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO program;
 
 INSERT INTO idp_users (user_uid, username, email, password_hash, full_name, role) VALUES ('1ce9ed92-8548-4ed9-a18e-d96fb120e622', 'admin', 'admin@test.ru', '8c6976e5b5410415bde908bd4dee15dfb167a9c873fc4bb8a81f6f2ab448a918', 'Admin', 'admin');
-INSERT INTO idp_users (user_uid, username, email, password_hash, full_name, role) VALUES ('2b1f83a3-9f95-4e5d-8f0f-3baf58c2f864', 'user', 'user@user.ru', '04f8996da763b7a969b1028ee3007569eaf3a635486ddab211d512c85b9df8fb', 'User', 'user');
\ No newline at end of file
+INSERT INTO idp_users (user_uid, username, email, password_hash, full_name, role) VALUES ('2b1f83a3-9f95-4e5d-8f0f-3baf58c2f864', 'user', 'user@user.ru', '04f8996da763b7a969b1028ee3007569eaf3a635486ddab211d512c85b9df8fb', 'User', 'user');
+
+\c gateway;
+
+CREATE TABLE jobs
+(
+    id          uuid PRIMARY KEY,
+    type        VARCHAR(80) NOT NULL,
+    payload     JSONB       NOT NULL,
+    status      VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'running', 'succeeded', 'dead')),
+    policy      JSONB       NOT NULL DEFAULT '{}',
+    attempts    INT         NOT NULL DEFAULT 0,
+    next_run_at TIMESTAMP   NOT NULL,
+    deadline    TIMESTAMP,
+    lease_until TIMESTAMP,
+    last_error  TEXT        NOT NULL DEFAULT '',
+    created_at  TIMESTAMP   NOT NULL,
+    updated_at  TIMESTAMP   NOT NULL
+);
+
+CREATE INDEX jobs_status_next_run_at_idx ON jobs (status, next_run_at);
+CREATE INDEX jobs_type_idx ON jobs (type);
+
+CREATE TABLE sagas
+(
+    id         uuid PRIMARY KEY,
+    name       VARCHAR(80) NOT NULL,
+    status     VARCHAR(20) NOT NULL
+        CHECK (status IN ('RUNNING', 'PENDING', 'COMPLETED', 'FAILED')),
+    current    INT         NOT NULL DEFAULT 0,
+    steps      JSONB       NOT NULL,
+    records    JSONB       NOT NULL,
+    error      TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMP   NOT NULL,
+    updated_at TIMESTAMP   NOT NULL
+);
+
+CREATE INDEX sagas_status_idx ON sagas (status, created_at);
+
+GRANT ALL ON ALL TABLES IN SCHEMA public TO program;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO program;
+
+\c statistics;
+
+CREATE TABLE events
+(
+    event_id        uuid PRIMARY KEY,
+    type            VARCHAR(80) NOT NULL,
+    schema_version  INT         NOT NULL,
+    occurred_at     TIMESTAMP   NOT NULL,
+    actor           VARCHAR(80) NOT NULL,
+    reservation_uid uuid,
+    book_uid        uuid,
+    library_uid     uuid,
+    rating_delta    INT         NOT NULL DEFAULT 0,
+    genre           VARCHAR(255) NOT NULL DEFAULT '',
+    city            VARCHAR(255) NOT NULL DEFAULT '',
+    received_at     TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX events_type_occurred_at_idx ON events (type, occurred_at);
+CREATE INDEX events_occurred_at_idx ON events (occurred_at);
+
+GRANT ALL ON ALL TABLES IN SCHEMA public TO program;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO program;
@@ -0,0 +1,154 @@
+// Package events defines the domain events published to the "events" Kafka
+// topic. Every message value is a JSON encoded Event:
+//
+//	{
+//	  "schemaVersion": 1,                         // integer, required
+//	  "eventId":       "uuid",                    // string, required, unique per event
+//	  "type":          "reservation.created",     // string, required, one of the Type constants
+//	  "occurredAt":    "2024-01-02T15:04:05Z",    // RFC 3339 UTC timestamp, required
+//	  "actor":         "username",                // string, user the event is about
+//	  "reservationUid": "uuid",                   // string, optional
+//	  "bookUid":       "uuid",                    // string, optional
+//	  "libraryUid":    "uuid",                    // string, optional
+//	  "holdUid":       "uuid",                    // string, optional, hold.* only
+//	  "ratingDelta":   -10,                       // integer, optional, rating.updated only
+//	  "amount":        150,                       // integer, optional, fine.* only
+//	  "copies":        2                          // integer, optional, holding.updated only, negative when retired
+//	}
+//
+// The message key is the reservation UID when present and the actor
+// otherwise, so events about one reservation keep their order. Fields may be
+// added within a schema version; removing or changing a field bumps
+// SchemaVersion, and consumers reject versions newer than they know.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	Topic         = "events"
+	SchemaVersion = 1
+)
+
+type Type string
+
+const (
+	ReservationCreated      Type = "reservation.created"
+	ReservationReturned     Type = "reservation.returned"
+	ReservationReturnedLate Type = "reservation.returned_late"
+	ReservationCancelled    Type = "reservation.cancelled"
+	ReservationRenewed      Type = "reservation.renewed"
+	ReservationOverdue      Type = "reservation.overdue"
+	RatingUpdated           Type = "rating.updated"
+
+	LibraryCreated Type = "library.created"
+	LibraryUpdated Type = "library.updated"
+	LibraryDeleted Type = "library.deleted"
+	BookCreated    Type = "book.created"
+	BookUpdated    Type = "book.updated"
+	BookDeleted    Type = "book.deleted"
+	HoldingUpdated Type = "holding.updated"
+	HoldingDeleted Type = "holding.deleted"
+
+	HoldPlaced    Type = "hold.placed"
+	HoldReady     Type = "hold.ready"
+	HoldExpired   Type = "hold.expired"
+	HoldCancelled Type = "hold.cancelled"
+
+	FineAssessed Type = "fine.assessed"
+	FinePaid     Type = "fine.paid"
+	FineWaived   Type = "fine.waived"
+)
+
+var labels = map[Type]string{
+	ReservationCreated:      "Книгу забронировали",
+	ReservationReturned:     "Книгу вернули вовремя",
+	ReservationReturnedLate: "Книгу вернули с опозданием",
+	ReservationCancelled:    "Бронирование отменено",
+	ReservationRenewed:      "Бронирование продлено",
+	ReservationOverdue:      "Книгу не вернули в срок",
+	RatingUpdated:           "Рейтинг обновился",
+	LibraryCreated:          "Библиотека добавлена",
+	LibraryUpdated:          "Библиотека изменена",
+	LibraryDeleted:          "Библиотека удалена",
+	BookCreated:             "Книга добавлена",
+	BookUpdated:             "Книга изменена",
+	BookDeleted:             "Книга удалена",
+	HoldingUpdated:          "Фонд библиотеки изменён",
+	HoldingDeleted:          "Книга изъята из фонда",
+	HoldPlaced:              "Читатель встал в очередь",
+	HoldReady:               "Книга ожидает читателя",
+	HoldExpired:             "Книгу не забрали вовремя",
+	HoldCancelled:           "Очередь на книгу отменена",
+	FineAssessed:            "Начислен штраф",
+	FinePaid:                "Штраф оплачен",
+	FineWaived:              "Штраф списан",
+}
+
+// Label returns the human readable name shown in statistics.
+func (t Type) Label() string {
+	if label, ok := labels[t]; ok {
+		return label
+	}
+
+	return string(t)
+}
+
+type Event struct {
+	SchemaVersion  int       `json:"schemaVersion"`
+	ID             string    `json:"eventId"`
+	Type           Type      `json:"type"`
+	OccurredAt     time.Time `json:"occurredAt"`
+	Actor          string    `json:"actor"`
+	ReservationUid string    `json:"reservationUid,omitempty"`
+	BookUid        string    `json:"bookUid,omitempty"`
+	LibraryUid     string    `json:"libraryUid,omitempty"`
+	HoldUid        string    `json:"holdUid,omitempty"`
+	RatingDelta    int       `json:"ratingDelta,omitempty"`
+	Amount         int       `json:"amount,omitempty"`
+	Copies         int       `json:"copies,omitempty"`
+}
+
+func New(eventType Type, actor string) Event {
+	return Event{
+		SchemaVersion: SchemaVersion,
+		ID:            uuid.New().String(),
+		Type:          eventType,
+		OccurredAt:    time.Now().UTC(),
+		Actor:         actor,
+	}
+}
+
+func (e Event) Key() string {
+	if e.ReservationUid != "" {
+		return e.ReservationUid
+	}
+
+	return e.Actor
+}
+
+func (e Event) Encode() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+func Decode(data []byte) (Event, error) {
+	var event Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return Event{}, fmt.Errorf("unable to decode event: %w", err)
+	}
+
+	if event.SchemaVersion < 1 || event.SchemaVersion > SchemaVersion {
+		return Event{}, fmt.Errorf("unsupported event schema version %d", event.SchemaVersion)
+	}
+	if event.ID == "" || event.Type == "" {
+		return Event{}, errors.New("event id and type are required")
+	}
+
+	return event, nil
+}
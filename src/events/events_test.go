@@ -0,0 +1,39 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	event := New(ReservationCreated, "user")
+	event.ReservationUid = "reservation"
+	event.BookUid = "book"
+	event.LibraryUid = "library"
+
+	data, err := event.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.ID != event.ID || decoded.Type != event.Type || decoded.ReservationUid != "reservation" ||
+		!decoded.OccurredAt.Equal(event.OccurredAt) {
+		t.Fatalf("unexpected event %+v", decoded)
+	}
+	if event.Key() != "reservation" {
+		t.Fatalf("expected reservation key, got %s", event.Key())
+	}
+}
+
+func TestDecodeRejectsUnknownVersion(t *testing.T) {
+	if _, err := Decode([]byte(`{"schemaVersion":2,"eventId":"1","type":"rating.updated"}`)); err == nil {
+		t.Fatal("expected error for newer schema version")
+	}
+	if _, err := Decode([]byte(`Книгу забронировали`)); err == nil {
+		t.Fatal("expected error for plain text message")
+	}
+}
@@ -0,0 +1,90 @@
+// Package cache provides the gateway's in-process cache for data owned by
+// other services.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache is a least recently used map of at most Size entries that turn stale
+// TTL after they are stored. Stale entries are still returned, flagged as
+// such, so callers can refresh them and fall back to them when the owning
+// service is unavailable.
+type Cache[V any] struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type entry[V any] struct {
+	key      string
+	value    V
+	storedAt time.Time
+}
+
+func New[V any](size int, ttl time.Duration) *Cache[V] {
+	return &Cache[V]{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value stored for key and whether it is still fresh.
+func (c *Cache[V]) Get(key string) (value V, fresh bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return value, false, false
+	}
+	c.order.MoveToFront(element)
+
+	e := element.Value.(*entry[V])
+	return e.value, c.now().Sub(e.storedAt) < c.ttl, true
+}
+
+func (c *Cache[V]) Set(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		e := element.Value.(*entry[V])
+		e.value, e.storedAt = value, c.now()
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&entry[V]{key: key, value: value, storedAt: c.now()})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry[V]).key)
+	}
+}
+
+func (c *Cache[V]) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	c := New[string](10, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Set("book", "Война и мир")
+
+	if value, fresh, ok := c.Get("book"); !ok || !fresh || value != "Война и мир" {
+		t.Fatalf("expected fresh entry, got %q fresh=%v ok=%v", value, fresh, ok)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if value, fresh, ok := c.Get("book"); !ok || fresh || value != "Война и мир" {
+		t.Fatalf("expected stale entry, got %q fresh=%v ok=%v", value, fresh, ok)
+	}
+
+	c.Set("book", "Анна Каренина")
+	if value, fresh, _ := c.Get("book"); !fresh || value != "Анна Каренина" {
+		t.Errorf("expected refreshed entry, got %q fresh=%v", value, fresh)
+	}
+
+	c.Delete("book")
+	if _, _, ok := c.Get("book"); ok {
+		t.Errorf("expected deleted entry to be gone")
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[int](2, time.Minute)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Set("c", 3)
+
+	if _, _, ok := c.Get("b"); ok {
+		t.Errorf("expected b to be evicted")
+	}
+	if _, _, ok := c.Get("a"); !ok {
+		t.Errorf("expected a to be kept")
+	}
+	if c.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", c.Len())
+	}
+}
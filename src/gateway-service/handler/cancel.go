@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CancelReservation cancels a book taken by mistake. Reservation-service only
+// allows it within the cancellation window; the copy goes back to the library
+// stock and, unlike ReturnBook, the reader's rating is left unchanged.
+func (h *Handler) CancelReservation(c *gin.Context) {
+	authToken := c.GetHeader("Authorization")
+
+	//getting reservation info
+	requestReservURL := fmt.Sprintf("%s/api/v1/reservations/info/%s", reservationService, c.Param("uid"))
+
+	resBody, err := h.sagaRequest(c.Request.Context(), h.reservationCB, httpJob{Method: http.MethodGet, URL: requestReservURL, Authorization: authToken}, "Reservation Service unavailable")
+	if err != nil {
+		h.cancelError(c, err)
+		return
+	}
+
+	var reservation ReservationResponse
+	if err = json.Unmarshal(resBody, &reservation); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	//the saga of a pending reservation restores the stock itself
+	if reservation.Status != "RENTED" && reservation.Status != "CANCELLED" {
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Message: "reservation cannot be cancelled",
+		})
+		return
+	}
+
+	requestCancelURL := fmt.Sprintf("%s/api/v1/reservations/%s/cancel", reservationService, c.Param("uid"))
+
+	resBody, err = h.sagaRequest(c.Request.Context(), h.reservationCB, httpJob{Method: http.MethodPost, URL: requestCancelURL, Authorization: authToken}, "Reservation Service unavailable")
+	if err != nil {
+		h.cancelError(c, err)
+		return
+	}
+
+	var cancelled ReservationResponse
+	if err = json.Unmarshal(resBody, &cancelled); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	//restoring count, shares the idempotency key with ReturnBook
+	if reservation.Status == "RENTED" {
+		requestCountURL := fmt.Sprintf("%s/api/v1/libraries/%s/books/%s/return", libraryService, reservation.Library_uid, reservation.Book_uid)
+
+		countJob := httpJob{Method: http.MethodPost, URL: requestCountURL, Username: reservation.Username, IdempotencyKey: "return:" + reservation.Reservation_uid}
+		if err = h.jobScheduler.Execute(c.Request.Context(), jobLibraryReturnBook, countJob); err != nil {
+			job, err := h.jobScheduler.Enqueue(jobLibraryReturnBook, countJob)
+			if err != nil {
+				fmt.Printf("failed to enqueue count update %s\n", err.Error())
+			} else {
+				fmt.Printf("count update for reservation %s deferred to job %s\n", reservation.Reservation_uid, job.ID)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, cancelled)
+}
+
+func (h *Handler) cancelError(c *gin.Context, err error) {
+	var srvErr *serviceError
+	if errors.As(err, &srvErr) {
+		c.JSON(srvErr.status, ErrorResponse{Message: srvErr.message})
+		return
+	}
+	c.JSON(http.StatusServiceUnavailable, ErrorResponse{Message: "Reservation Service unavailable"})
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sony/gobreaker"
+)
+
+// ProxyCatalogue forwards catalogue search and librarian catalogue changes to
+// the same path on library-service, which validates them and checks the admin
+// role again.
+func (h *Handler) ProxyCatalogue(c *gin.Context) {
+	status := h.proxy(c, h.libraryCB, libraryService, "Library Service unavailable")
+
+	//changes made through this instance are dropped without waiting for the event
+	if status >= http.StatusOK && status < http.StatusBadRequest {
+		switch c.FullPath() {
+		case "/api/v1/books/:uid":
+			h.books.Delete(c.Param("uid"))
+		case "/api/v1/libraries/:uid":
+			h.libraries.Delete(c.Param("uid"))
+		}
+	}
+}
+
+// ProxyReservation forwards reader requests that need no other service, such
+// as holds and renewals, to reservation-service.
+func (h *Handler) ProxyReservation(c *gin.Context) {
+	h.proxy(c, h.reservationCB, reservationService, "Reservation Service unavailable")
+}
+
+// proxy forwards the request to the same path on service and copies the
+// response back. It returns the status of the service response, zero when
+// there was none.
+func (h *Handler) proxy(c *gin.Context, cb *gobreaker.CircuitBreaker, service string, unavailable string) int {
+	requestURL := fmt.Sprintf("%s%s", service, c.Request.URL.Path)
+	if c.Request.URL.RawQuery != "" {
+		requestURL += "?" + c.Request.URL.RawQuery
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, requestURL, c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Message: err.Error(),
+		})
+		return 0
+	}
+
+	req.Header.Set("Authorization", c.GetHeader("Authorization"))
+	req.Header.Set("Content-Type", "application/json")
+
+	ires, err := cb.Execute(func() (any, error) {
+		return http.DefaultClient.Do(req)
+	})
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Message: unavailable})
+		return 0
+	}
+
+	res, ok := ires.(*http.Response)
+	if !ok {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return 0
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return 0
+	}
+
+	if len(resBody) == 0 {
+		c.Status(res.StatusCode)
+		return res.StatusCode
+	}
+
+	c.Data(res.StatusCode, "application/json", resBody)
+	return res.StatusCode
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const gatewayClientId = "gateway"
+
+// serviceCredentials obtains the gateway's own access token from the IdP with
+// the client_credentials grant. Deferred calls are made with it, naming the
+// reader in the X-Acting-User header, so no reader token is ever persisted.
+type serviceCredentials struct {
+	clientSecret string
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+type serviceTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// authorization returns the Authorization header value, fetching a new token
+// a minute before the cached one expires.
+func (sc *serviceCredentials) authorization(ctx context.Context) (string, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.token != "" && time.Now().Before(sc.expiresAt) {
+		return "Bearer " + sc.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {gatewayClientId},
+		"client_secret": {sc.clientSecret},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, idpInternalService+"/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("service token: %d", res.StatusCode)
+	}
+
+	var tokenRes serviceTokenResponse
+	if err = json.NewDecoder(res.Body).Decode(&tokenRes); err != nil {
+		return "", err
+	}
+
+	sc.token = tokenRes.AccessToken
+	sc.expiresAt = time.Now().Add(time.Duration(tokenRes.ExpiresIn)*time.Second - time.Minute)
+
+	return "Bearer " + sc.token, nil
+}
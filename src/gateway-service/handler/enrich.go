@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"lab2/src/gateway-service/cache"
+	"lab2/src/pagination"
+)
+
+// catalogue holds the books and libraries referenced by a list of
+// reservations. Entries neither cached nor returned by library-service are
+// missing and are rendered with their uid only.
+type catalogue struct {
+	books     map[string]BookToUserResponse
+	libraries map[string]LibraryResponse
+}
+
+func (cat catalogue) book(uid string) BookToUserResponse {
+	if book, ok := cat.books[uid]; ok {
+		return book
+	}
+	return BookToUserResponse{Book_uid: uid}
+}
+
+func (cat catalogue) library(uid string) LibraryResponse {
+	if library, ok := cat.libraries[uid]; ok {
+		return library
+	}
+	return LibraryResponse{Library_uid: uid}
+}
+
+// lookupCatalogue resolves the books and libraries of reservations, from the
+// cache where fresh and otherwise with the library-service batch endpoints.
+// Books and libraries are fetched concurrently, one request per
+// pagination.MaxSize uids.
+func (h *Handler) lookupCatalogue(authToken string, reservations []ReservationResponse) catalogue {
+	bookUids := make([]string, 0, len(reservations))
+	libraryUids := make([]string, 0, len(reservations))
+	for _, reservation := range reservations {
+		bookUids = append(bookUids, reservation.Book_uid)
+		libraryUids = append(libraryUids, reservation.Library_uid)
+	}
+
+	var cat catalogue
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		cat.books = resolve(h, h.books, "/api/v1/books", authToken, bookUids, func(book BookToUserResponse) string {
+			return book.Book_uid
+		})
+	}()
+
+	go func() {
+		defer wg.Done()
+		cat.libraries = resolve(h, h.libraries, "/api/v1/libraries", authToken, libraryUids, func(library LibraryResponse) string {
+			return library.Library_uid
+		})
+	}()
+
+	wg.Wait()
+
+	return cat
+}
+
+// resolve looks uids up in the cache and fetches the missing and stale ones.
+// When the fetch fails, stale entries are served as they are; when it
+// succeeds, uids library-service no longer knows are dropped from the cache.
+func resolve[T any](h *Handler, c *cache.Cache[T], path string, authToken string, uids []string, key func(T) string) map[string]T {
+	uids = unique(uids)
+	res := make(map[string]T, len(uids))
+
+	missing := make([]string, 0)
+	for _, uid := range uids {
+		value, fresh, ok := c.Get(uid)
+		if ok {
+			res[uid] = value
+		}
+		if !fresh {
+			missing = append(missing, uid)
+		}
+	}
+
+	if len(missing) == 0 {
+		return res
+	}
+
+	items, err := fetchBatch[T](h, path, authToken, missing)
+	for _, item := range items {
+		c.Set(key(item), item)
+		res[key(item)] = item
+	}
+
+	if err != nil {
+		fmt.Printf("failed to get %s %s\n", path, err.Error())
+		return res
+	}
+
+	fetched := make(map[string]bool, len(items))
+	for _, item := range items {
+		fetched[key(item)] = true
+	}
+	for _, uid := range missing {
+		if !fetched[uid] {
+			c.Delete(uid)
+			delete(res, uid)
+		}
+	}
+
+	return res
+}
+
+// fetchBatch requests uids from a library-service batch endpoint in chunks
+// and returns what was fetched before the first failure.
+func fetchBatch[T any](h *Handler, path string, authToken string, uids []string) ([]T, error) {
+	items := make([]T, 0, len(uids))
+
+	for start := 0; start < len(uids); start += pagination.MaxSize {
+		end := min(start+pagination.MaxSize, len(uids))
+
+		q := url.Values{}
+		q.Set("uids", strings.Join(uids[start:end], ","))
+
+		req, err := http.NewRequest(http.MethodGet, libraryService+path+"?"+q.Encode(), nil)
+		if err != nil {
+			return items, err
+		}
+		req.Header.Set("Authorization", authToken)
+
+		ires, err := h.libraryCB.Execute(func() (any, error) {
+			return http.DefaultClient.Do(req)
+		})
+		if err != nil {
+			return items, fmt.Errorf("library service unavailable: %w", err)
+		}
+
+		res, ok := ires.(*http.Response)
+		if !ok {
+			return items, fmt.Errorf("unexpected response")
+		}
+
+		resBody, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return items, err
+		}
+
+		if res.StatusCode != http.StatusOK {
+			return items, fmt.Errorf("GET %s: %d", path, res.StatusCode)
+		}
+
+		var chunk []T
+		if err = json.Unmarshal(resBody, &chunk); err != nil {
+			return items, err
+		}
+		items = append(items, chunk...)
+	}
+
+	return items, nil
+}
+
+func unique(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	res := make([]string, 0, len(values))
+
+	for _, value := range values {
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		res = append(res, value)
+	}
+
+	return res
+}
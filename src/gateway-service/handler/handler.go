@@ -3,13 +3,19 @@ package handler
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"lab2/src/gateway-service/cache"
+	"lab2/src/gateway-service/saga"
 	"lab2/src/jobqueue"
+	"lab2/src/pagination"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/sony/gobreaker"
 )
 
@@ -18,19 +24,29 @@ type Handler struct {
 	ratingCB      *gobreaker.CircuitBreaker
 	reservationCB *gobreaker.CircuitBreaker
 	jobScheduler  *jobqueue.JobScheduler
+	orchestrator  *saga.Orchestrator
+	credentials   *serviceCredentials
+	books         *cache.Cache[BookToUserResponse]
+	libraries     *cache.Cache[LibraryResponse]
 }
 
-func NewHandler(libraryCircuitBreaker, ratingCircuitBreaker, reservationCircuitBreaker *gobreaker.CircuitBreaker, jobScheduler *jobqueue.JobScheduler) *Handler {
-	return &Handler{
+func NewHandler(libraryCircuitBreaker, ratingCircuitBreaker, reservationCircuitBreaker *gobreaker.CircuitBreaker, jobScheduler *jobqueue.JobScheduler, sagaStore saga.Store, clientSecret string) *Handler {
+	h := &Handler{
 		libraryCB:     libraryCircuitBreaker,
 		ratingCB:      ratingCircuitBreaker,
 		reservationCB: reservationCircuitBreaker,
 		jobScheduler:  jobScheduler,
+		orchestrator:  saga.NewOrchestrator(jobScheduler, sagaStore),
+		credentials:   &serviceCredentials{clientSecret: clientSecret},
+		books:         cache.New[BookToUserResponse](catalogueCacheSize, catalogueCacheTTL),
+		libraries:     cache.New[LibraryResponse](catalogueCacheSize, catalogueCacheTTL),
 	}
+	h.registerJobs(jobScheduler)
+
+	return h
 }
 
 func (h *Handler) GetLibrariesByCity(c *gin.Context) {
-	params := c.Request.URL.Query()
 	requestURL := fmt.Sprintf("%s/api/v1/libraries/", libraryService)
 
 	req, err := http.NewRequest(http.MethodGet, requestURL, nil)
@@ -41,7 +57,7 @@ func (h *Handler) GetLibrariesByCity(c *gin.Context) {
 		return
 	}
 
-	q := req.URL.Query()
+	q := pageQuery(c)
 	q.Add("city", c.Query("city"))
 	req.URL.RawQuery = q.Encode()
 
@@ -58,6 +74,7 @@ func (h *Handler) GetLibrariesByCity(c *gin.Context) {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
+	defer res.Body.Close()
 
 	resBody, err := io.ReadAll(res.Body)
 	if err != nil {
@@ -67,61 +84,23 @@ func (h *Handler) GetLibrariesByCity(c *gin.Context) {
 		return
 	}
 
-	var libraries []LibraryResponse
-	if err = json.Unmarshal(resBody, &libraries); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: err.Error(),
-		})
+	if res.StatusCode != http.StatusOK {
+		c.Data(res.StatusCode, "application/json", resBody)
 		return
 	}
 
-	pageParam := params.Get("page")
-	if pageParam == "" {
-		pageParam = "1"
-	}
-	page, err := strconv.Atoi(pageParam)
-	if err != nil {
+	var data LibrariesLimited
+	if err = json.Unmarshal(resBody, &data); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
 		return
 	}
 
-	sizeParam := params.Get("size")
-	if sizeParam == "" {
-		sizeParam = "100"
-	}
-	size, err := strconv.Atoi(sizeParam)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: err.Error(),
-		})
-		return
-	}
-
-	right := page * size
-	if len(libraries) < right {
-		right = len(libraries)
-	}
-
-	librariesStripped := make([]LibraryResponse, 0)
-
-	if (page-1)*size <= len(libraries) {
-		librariesStripped = libraries[(page-1)*size : right]
-	}
-
-	data := LibrariesLimited{
-		Page:          page,
-		PageSize:      size,
-		TotalElements: len(librariesStripped),
-		Items:         librariesStripped,
-	}
-
 	c.JSON(http.StatusOK, data)
 }
 
 func (h *Handler) GetBooksByLibraryUid(c *gin.Context) {
-	params := c.Request.URL.Query()
 	requestURL := fmt.Sprintf("%s/api/v1/libraries/%s/books/", libraryService, c.Param("uid"))
 
 	req, err := http.NewRequest(http.MethodGet, requestURL, nil)
@@ -132,7 +111,7 @@ func (h *Handler) GetBooksByLibraryUid(c *gin.Context) {
 		return
 	}
 
-	q := req.URL.Query()
+	q := pageQuery(c)
 	q.Add("showAll", c.Query("showAll"))
 	req.URL.RawQuery = q.Encode()
 
@@ -149,6 +128,7 @@ func (h *Handler) GetBooksByLibraryUid(c *gin.Context) {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
+	defer res.Body.Close()
 
 	resBody, err := io.ReadAll(res.Body)
 	if err != nil {
@@ -158,59 +138,32 @@ func (h *Handler) GetBooksByLibraryUid(c *gin.Context) {
 		return
 	}
 
-	var books []BookResponse
-	if err = json.Unmarshal(resBody, &books); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: err.Error(),
-		})
+	if res.StatusCode != http.StatusOK {
+		c.Data(res.StatusCode, "application/json", resBody)
 		return
 	}
 
-	fmt.Println(books)
-
-	pageParam := params.Get("page")
-	if pageParam == "" {
-		pageParam = "1"
-	}
-	page, err := strconv.Atoi(pageParam)
-	if err != nil {
+	var data BookLimited
+	if err = json.Unmarshal(resBody, &data); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
 		return
 	}
 
-	sizeParam := params.Get("size")
-	if sizeParam == "" {
-		sizeParam = "100"
-	}
-	size, err := strconv.Atoi(sizeParam)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: err.Error(),
-		})
-		return
-	}
-
-	right := page * size
-	if len(books) < right {
-		right = len(books)
-	}
-
-	booksStripped := make([]BookResponse, 0)
-
-	if (page-1)*size <= len(books) {
-		booksStripped = books[(page-1)*size : right]
-	}
+	c.JSON(http.StatusOK, data)
+}
 
-	data := BookLimited{
-		Page:          page,
-		PageSize:      size,
-		TotalElements: len(booksStripped),
-		Items:         booksStripped,
+// pageQuery copies the pagination parameters of the request so the
+// downstream service pages and sorts in the database.
+func pageQuery(c *gin.Context) url.Values {
+	q := url.Values{}
+	for _, key := range []string{"page", "size", "sort"} {
+		if value := c.Query(key); value != "" {
+			q.Set(key, value)
+		}
 	}
-
-	c.JSON(http.StatusOK, data)
+	return q
 }
 
 func (h *Handler) GetRating(c *gin.Context) {
@@ -264,6 +217,9 @@ func (h *Handler) GetRating(c *gin.Context) {
 
 func (h *Handler) Stats(c *gin.Context) {
 	requestURL := fmt.Sprintf("%s/api/v1/statistics", statisticsService)
+	if c.Request.URL.RawQuery != "" {
+		requestURL += "?" + c.Request.URL.RawQuery
+	}
 
 	req, err := http.NewRequest(http.MethodGet, requestURL, nil)
 	if err != nil {
@@ -294,354 +250,175 @@ func (h *Handler) Stats(c *gin.Context) {
 	c.Data(res.StatusCode, "application/json", resBody)
 }
 
-func (h *Handler) GetReservations(c *gin.Context) {
-	requestURL := fmt.Sprintf("%s/api/v1/reservations/", reservationService)
+// isPaged reports whether the client asked for a page. Requests without
+// pagination parameters keep the original array response.
+func isPaged(c *gin.Context) bool {
+	return len(pageQuery(c)) > 0
+}
 
-	req, err := http.NewRequest(http.MethodGet, requestURL, nil)
+// fetchReservations loads reservations from reservation-service, all pages of
+// them unless the client asked for a single page. On failure the error
+// response is already written.
+func (h *Handler) fetchReservations(c *gin.Context, path string) (ReservationsPage, bool) {
+	q := pageQuery(c)
+	if isPaged(c) {
+		return h.fetchReservationsPage(c, path, q)
+	}
+
+	q.Set("size", strconv.Itoa(pagination.MaxSize))
+
+	var all ReservationsPage
+	for number := 1; ; number++ {
+		q.Set("page", strconv.Itoa(number))
+
+		page, ok := h.fetchReservationsPage(c, path, q)
+		if !ok {
+			return all, false
+		}
+
+		all.Items = append(all.Items, page.Items...)
+		if number >= page.TotalPages {
+			all.Page, all.PageSize = 1, len(all.Items)
+			all.TotalElements, all.TotalPages = page.TotalElements, 1
+			return all, true
+		}
+	}
+}
+
+func (h *Handler) fetchReservationsPage(c *gin.Context, path string, q url.Values) (ReservationsPage, bool) {
+	var page ReservationsPage
+
+	req, err := http.NewRequest(http.MethodGet, reservationService+path, nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Message: err.Error(),
 		})
-		return
+		return page, false
 	}
-
-	authToken := c.GetHeader("Authorization")
-	req.Header.Set("Authorization", authToken)
+	req.URL.RawQuery = q.Encode()
+	req.Header.Set("Authorization", c.GetHeader("Authorization"))
 
 	ires, err := h.reservationCB.Execute(func() (any, error) {
 		return http.DefaultClient.Do(req)
 	})
 	if err != nil {
 		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Message: "Reservation Service unavailable"})
-		return
+		return page, false
 	}
 
 	res, ok := ires.(*http.Response)
 	if !ok {
 		c.AbortWithStatus(http.StatusInternalServerError)
-		return
+		return page, false
 	}
+	defer res.Body.Close()
 
 	resBody, err := io.ReadAll(res.Body)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
-		return
+		return page, false
 	}
 
-	var reservations []ReservationResponse
-	if err = json.Unmarshal(resBody, &reservations); err != nil {
+	if res.StatusCode != http.StatusOK {
+		c.Data(res.StatusCode, "application/json", resBody)
+		return page, false
+	}
+
+	if err = json.Unmarshal(resBody, &page); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
-		return
+		return page, false
 	}
 
-	response := make([]ReservationToUserResponse, len(reservations))
-
-	for i, reservation := range reservations {
-		requestBookURL := fmt.Sprintf("%s/api/v1/books/%s/", libraryService, reservation.Book_uid)
-
-		req, err := http.NewRequest(http.MethodGet, requestBookURL, nil)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, ErrorResponse{
-				Message: err.Error(),
-			})
-			return
-		}
-		req.Header.Set("Authorization", authToken)
-
-		ires, err := h.libraryCB.Execute(func() (any, error) {
-			return http.DefaultClient.Do(req)
-		})
-		if err != nil {
-
-			var book BookToUserResponse
-			book.Book_uid = reservation.Book_uid
-
-			var library LibraryResponse
-			library.Library_uid = reservation.Library_uid
-
-			response[i] = ReservationToUserResponse{
-				Reservation_uid: reservation.Reservation_uid,
-				Status:          reservation.Status,
-				Start_date:      reservation.Start_date,
-				Till_date:       reservation.Till_date,
-				Book:            book,
-				Library:         library,
-			}
-
-			fmt.Println("Library Service unavailable")
-			continue
-		}
-
-		res, ok := ires.(*http.Response)
-		if !ok {
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
-
-		resBody, err := io.ReadAll(res.Body)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, ErrorResponse{
-				Message: err.Error(),
-			})
-			return
-		}
-
-		var book BookToUserResponse
-		if err = json.Unmarshal(resBody, &book); err != nil {
-			c.JSON(http.StatusBadRequest, ErrorResponse{
-				Message: err.Error(),
-			})
-			return
-		}
-
-		requestLibraryURL := fmt.Sprintf("%s/api/v1/libraries/%s/", libraryService, reservation.Library_uid)
-
-		reqLib, err := http.NewRequest(http.MethodGet, requestLibraryURL, nil)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, ErrorResponse{
-				Message: err.Error(),
-			})
-			return
-		}
-		reqLib.Header.Set("Authorization", authToken)
-
-		iresLib, err := h.libraryCB.Execute(func() (any, error) {
-			return http.DefaultClient.Do(reqLib)
-		})
-		if err != nil {
-			var book BookToUserResponse
-			book.Book_uid = reservation.Book_uid
-
-			var library LibraryResponse
-			library.Library_uid = reservation.Library_uid
-
-			response[i] = ReservationToUserResponse{
-				Reservation_uid: reservation.Reservation_uid,
-				Status:          reservation.Status,
-				Start_date:      reservation.Start_date,
-				Till_date:       reservation.Till_date,
-				Book:            book,
-				Library:         library,
-			}
-
-			fmt.Println("Library Service unavailable")
-			continue
-		}
+	return page, true
+}
 
-		resLib, ok := iresLib.(*http.Response)
-		if !ok {
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
+func (h *Handler) GetReservations(c *gin.Context) {
+	authToken := c.GetHeader("Authorization")
 
-		resLibBody, err := io.ReadAll(resLib.Body)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, ErrorResponse{
-				Message: err.Error(),
-			})
-			return
-		}
+	page, ok := h.fetchReservations(c, "/api/v1/reservations/")
+	if !ok {
+		return
+	}
+	reservations := page.Items
 
-		var library LibraryResponse
-		if err = json.Unmarshal(resLibBody, &library); err != nil {
-			c.JSON(http.StatusBadRequest, ErrorResponse{
-				Message: err.Error(),
-			})
-			return
-		}
+	cat := h.lookupCatalogue(authToken, reservations)
 
+	response := make([]ReservationToUserResponse, len(reservations))
+	for i, reservation := range reservations {
 		response[i] = ReservationToUserResponse{
 			Reservation_uid: reservation.Reservation_uid,
 			Status:          reservation.Status,
 			Start_date:      reservation.Start_date,
 			Till_date:       reservation.Till_date,
-			Book:            book,
-			Library:         library,
+			Book:            cat.book(reservation.Book_uid),
+			Library:         cat.library(reservation.Library_uid),
 		}
+	}
 
+	if !isPaged(c) {
+		c.JSON(http.StatusOK, response)
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, ReservationsLimited{
+		Page:          page.Page,
+		PageSize:      page.PageSize,
+		TotalElements: page.TotalElements,
+		TotalPages:    page.TotalPages,
+		Items:         response,
+	})
 }
 
 func (h *Handler) GetReservationsAll(c *gin.Context) {
-	requestURL := fmt.Sprintf("%s/api/v1/reservations/all", reservationService)
+	h.listReaderReservations(c, "/api/v1/reservations/all")
+}
 
-	req, err := http.NewRequest(http.MethodGet, requestURL, nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Message: err.Error(),
-		})
-		return
-	}
+func (h *Handler) GetReservationsOverdue(c *gin.Context) {
+	h.listReaderReservations(c, "/api/v1/reservations/overdue")
+}
 
+// listReaderReservations serves librarian listings, which name the reader
+// of every reservation.
+func (h *Handler) listReaderReservations(c *gin.Context, path string) {
 	authToken := c.GetHeader("Authorization")
-	req.Header.Set("Authorization", authToken)
-
-	ires, err := h.reservationCB.Execute(func() (any, error) {
-		return http.DefaultClient.Do(req)
-	})
-	if err != nil {
-		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Message: "Reservation Service unavailable"})
-		return
-	}
 
-	res, ok := ires.(*http.Response)
+	page, ok := h.fetchReservations(c, path)
 	if !ok {
-		c.AbortWithStatus(http.StatusInternalServerError)
-		return
-	}
-
-	resBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: err.Error(),
-		})
 		return
 	}
+	reservations := page.Items
 
-	var reservations []ReservationResponse
-	if err = json.Unmarshal(resBody, &reservations); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: err.Error(),
-		})
-		return
-	}
+	cat := h.lookupCatalogue(authToken, reservations)
 
 	response := make([]ReservationsResponse, len(reservations))
-
 	for i, reservation := range reservations {
-		requestBookURL := fmt.Sprintf("%s/api/v1/books/%s/", libraryService, reservation.Book_uid)
-
-		req, err := http.NewRequest(http.MethodGet, requestBookURL, nil)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, ErrorResponse{
-				Message: err.Error(),
-			})
-			return
-		}
-		req.Header.Set("Authorization", authToken)
-
-		ires, err := h.libraryCB.Execute(func() (any, error) {
-			return http.DefaultClient.Do(req)
-		})
-		if err != nil {
-			var book BookToUserResponse
-			book.Book_uid = reservation.Book_uid
-
-			var library LibraryResponse
-			library.Library_uid = reservation.Library_uid
-
-			response[i] = ReservationsResponse{
-				Reservation_uid: reservation.Reservation_uid,
-				Status:          reservation.Status,
-				Start_date:      reservation.Start_date,
-				Till_date:       reservation.Till_date,
-				Book:            book,
-				Library:         library,
-			}
-
-			fmt.Println("Library Service unavailable")
-			continue
-		}
-
-		res, ok := ires.(*http.Response)
-		if !ok {
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
-
-		resBody, err := io.ReadAll(res.Body)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, ErrorResponse{
-				Message: err.Error(),
-			})
-			return
-		}
-
-		var book BookToUserResponse
-		if err = json.Unmarshal(resBody, &book); err != nil {
-			c.JSON(http.StatusBadRequest, ErrorResponse{
-				Message: err.Error(),
-			})
-			return
-		}
-
-		requestLibraryURL := fmt.Sprintf("%s/api/v1/libraries/%s/", libraryService, reservation.Library_uid)
-
-		reqLib, err := http.NewRequest(http.MethodGet, requestLibraryURL, nil)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, ErrorResponse{
-				Message: err.Error(),
-			})
-			return
-		}
-		reqLib.Header.Set("Authorization", authToken)
-
-		iresLib, err := h.libraryCB.Execute(func() (any, error) {
-			return http.DefaultClient.Do(reqLib)
-		})
-		if err != nil {
-			var book BookToUserResponse
-			book.Book_uid = reservation.Book_uid
-
-			var library LibraryResponse
-			library.Library_uid = reservation.Library_uid
-
-			response[i] = ReservationsResponse{
-				Reservation_uid: reservation.Reservation_uid,
-				Status:          reservation.Status,
-				Start_date:      reservation.Start_date,
-				Till_date:       reservation.Till_date,
-				Book:            book,
-				Library:         library,
-			}
-
-			fmt.Println("Library Service unavailable")
-			continue
-		}
-
-		resLib, ok := iresLib.(*http.Response)
-		if !ok {
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
-
-		resLibBody, err := io.ReadAll(resLib.Body)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, ErrorResponse{
-				Message: err.Error(),
-			})
-			return
-		}
-
-		var library LibraryResponse
-		if err = json.Unmarshal(resLibBody, &library); err != nil {
-			c.JSON(http.StatusBadRequest, ErrorResponse{
-				Message: err.Error(),
-			})
-			return
-		}
-
-		username := Username{Name: reservation.Username}
-
 		response[i] = ReservationsResponse{
 			Reservation_uid: reservation.Reservation_uid,
 			Status:          reservation.Status,
 			Start_date:      reservation.Start_date,
 			Till_date:       reservation.Till_date,
-			Book:            book,
-			Library:         library,
-			Username:        username,
+			Book:            cat.book(reservation.Book_uid),
+			Library:         cat.library(reservation.Library_uid),
+			Username:        Username{Name: reservation.Username},
 		}
+	}
 
+	if !isPaged(c) {
+		c.JSON(http.StatusOK, response)
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, AllReservationsLimited{
+		Page:          page.Page,
+		PageSize:      page.PageSize,
+		TotalElements: page.TotalElements,
+		TotalPages:    page.TotalPages,
+		Items:         response,
+	})
 }
 
 func (h *Handler) CreateReservation(c *gin.Context) {
@@ -668,6 +445,7 @@ func (h *Handler) CreateReservation(c *gin.Context) {
 	}
 
 	authToken := c.GetHeader("Authorization")
+	username := c.GetString("username")
 	reqAmount.Header.Set("Authorization", authToken)
 
 	iresAmount, err := h.reservationCB.Execute(func() (any, error) {
@@ -749,51 +527,8 @@ func (h *Handler) CreateReservation(c *gin.Context) {
 		return
 	}
 
-	//create reservation
-	requestCreateURL := fmt.Sprintf("%s/api/v1/reservations", reservationService)
-
-	marshalled, err := json.Marshal(inputCreateBody)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: err.Error(),
-		})
-	}
-
-	reqCreate, err := http.NewRequest(http.MethodPost, requestCreateURL, bytes.NewReader(marshalled))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Message: err.Error(),
-		})
-		return
-	}
-	reqCreate.Header.Set("Authorization", authToken)
-
-	resCreate, err := http.DefaultClient.Do(reqCreate)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Message: err.Error(),
-		})
-		return
-	}
-
-	resBodyCreate, err := io.ReadAll(resCreate.Body)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: err.Error(),
-		})
-		return
-	}
-
-	var createReserv ReservationResponse
-	if err = json.Unmarshal(resBodyCreate, &createReserv); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: err.Error(),
-		})
-		return
-	}
-
-	//create response
-	requestBookURL := fmt.Sprintf("%s/api/v1/books/%s/", libraryService, createReserv.Book_uid)
+	//getting book and library info
+	requestBookURL := fmt.Sprintf("%s/api/v1/books/%s/", libraryService, inputCreateBody.BookUid)
 
 	reqBook, err := http.NewRequest(http.MethodGet, requestBookURL, nil)
 	if err != nil {
@@ -834,7 +569,7 @@ func (h *Handler) CreateReservation(c *gin.Context) {
 		return
 	}
 
-	requestLibraryURL := fmt.Sprintf("%s/api/v1/libraries/%s/", libraryService, createReserv.Library_uid)
+	requestLibraryURL := fmt.Sprintf("%s/api/v1/libraries/%s/", libraryService, inputCreateBody.LibraryUid)
 
 	reqLib, err := http.NewRequest(http.MethodGet, requestLibraryURL, nil)
 	if err != nil {
@@ -875,43 +610,110 @@ func (h *Handler) CreateReservation(c *gin.Context) {
 		return
 	}
 
-	response := TakeBookResponse{
-		Reservation_uid: createReserv.Reservation_uid,
-		Status:          createReserv.Status,
-		Start_date:      createReserv.Start_date,
-		Till_date:       createReserv.Till_date,
-		Book:            book,
-		Library:         library,
-		Rating:          rating,
-	}
+	//reservation saga: create a pending reservation, take the book, then confirm the reservation
+	inputCreateBody.ReservationUid = uuid.New().String()
 
-	//update count
-	requestUpdateCountURL := fmt.Sprintf("%s/api/v1/books/%s/count/0", libraryService, book.Book_uid)
-
-	reqCount, err := http.NewRequest(http.MethodPut, requestUpdateCountURL, nil)
+	marshalled, err := json.Marshal(inputCreateBody)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
+		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
 		return
 	}
-	reqCount.Header.Set("Authorization", authToken)
 
-	resCount, err := http.DefaultClient.Do(reqCount)
+	requestCreateURL := fmt.Sprintf("%s/api/v1/reservations", reservationService)
+	requestCancelURL := fmt.Sprintf("%s/api/v1/reservations/%s/cancel", reservationService, inputCreateBody.ReservationUid)
+	requestConfirmURL := fmt.Sprintf("%s/api/v1/reservations/%s/confirm", reservationService, inputCreateBody.ReservationUid)
+	requestTakeURL := fmt.Sprintf("%s/api/v1/libraries/%s/books/%s/take", libraryService, inputCreateBody.LibraryUid, inputCreateBody.BookUid)
+	requestRestoreURL := fmt.Sprintf("%s/api/v1/libraries/%s/books/%s/return", libraryService, inputCreateBody.LibraryUid, inputCreateBody.BookUid)
+
+	reservationSaga := h.orchestrator.New("create-reservation",
+		saga.Step{
+			Name: "create reservation",
+			Action: saga.Command{
+				Type:    jobReservationCreate,
+				Payload: httpJob{Method: http.MethodPost, URL: requestCreateURL, Username: username, Body: marshalled},
+			},
+			Compensate: &saga.Command{
+				Type:    jobReservationCancel,
+				Payload: httpJob{Method: http.MethodPost, URL: requestCancelURL, Username: username},
+			},
+		},
+		saga.Step{
+			Name: "take book",
+			Action: saga.Command{
+				Type:    jobLibraryTakeBook,
+				Payload: httpJob{Method: http.MethodPost, URL: requestTakeURL, Username: username, IdempotencyKey: "take:" + inputCreateBody.ReservationUid},
+			},
+			Compensate: &saga.Command{
+				Type:    jobLibraryReturnBook,
+				Payload: httpJob{Method: http.MethodPost, URL: requestRestoreURL, Username: username, IdempotencyKey: "return:" + inputCreateBody.ReservationUid},
+			},
+		},
+		saga.Step{
+			Name: "confirm reservation",
+			Action: saga.Command{
+				Type:    jobReservationConfirm,
+				Payload: httpJob{Method: http.MethodPost, URL: requestConfirmURL, Username: username},
+			},
+		},
+	)
+
+	err = h.orchestrator.Run(c.Request.Context(), reservationSaga)
+	if errors.Is(err, saga.ErrPending) {
+		c.JSON(http.StatusAccepted, PendingReservationResponse{
+			Reservation_uid: inputCreateBody.ReservationUid,
+			Saga_id:         reservationSaga.ID,
+			Status:          "PENDING",
+			Message:         "reservation is being processed",
+		})
+		return
+	}
+	if err != nil {
+		var srvErr *serviceError
+		if errors.As(err, &srvErr) && srvErr.status == http.StatusBadRequest && json.Valid(srvErr.body) {
+			c.Data(srvErr.status, "application/json", srvErr.body)
+			return
+		}
+		if errors.As(err, &srvErr) {
+			c.JSON(srvErr.status, ErrorResponse{Message: srvErr.message})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+		return
+	}
+
+	//the response reflects the reservation as stored by reservation-service
+	requestReservURL := fmt.Sprintf("%s/api/v1/reservations/info/%s", reservationService, inputCreateBody.ReservationUid)
+
+	resBody, err := h.sagaRequest(c.Request.Context(), h.reservationCB, httpJob{Method: http.MethodGet, URL: requestReservURL, Authorization: authToken}, "Reservation Service unavailable")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Message: err.Error(),
+		c.JSON(http.StatusAccepted, PendingReservationResponse{
+			Reservation_uid: inputCreateBody.ReservationUid,
+			Saga_id:         reservationSaga.ID,
+			Message:         "reservation is created, details are unavailable",
 		})
 		return
 	}
 
-	if resCount.StatusCode != 200 {
+	var reservation ReservationResponse
+	if err = json.Unmarshal(resBody, &reservation); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Message: "error while updating count",
+			Message: err.Error(),
 		})
 		return
 	}
 
+	response := TakeBookResponse{
+		Reservation_uid: reservation.Reservation_uid,
+		Status:          reservation.Status,
+		Start_date:      reservation.Start_date,
+		Till_date:       reservation.Till_date,
+		Book:            book,
+		Library:         library,
+		Rating:          rating,
+	}
+
 	c.JSON(http.StatusOK, response)
 }
 
@@ -1001,6 +803,19 @@ func (h *Handler) ReturnBook(c *gin.Context) {
 		return
 	}
 
+	//the reservation is not rented anymore, e.g. the book was already returned
+	if resStatus.StatusCode >= http.StatusBadRequest {
+		resBodyStatus, err := io.ReadAll(resStatus.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Message: err.Error(),
+			})
+			return
+		}
+		c.Data(resStatus.StatusCode, "application/json", resBodyStatus)
+		return
+	}
+
 	if resStatus.StatusCode == 204 {
 		resFee = resFee + 1
 	}
@@ -1030,23 +845,16 @@ func (h *Handler) ReturnBook(c *gin.Context) {
 	}
 
 	//updating count
-	requestCountURL := fmt.Sprintf("%s/api/v1/books/%s/count/1/", libraryService, reservation.Book_uid)
+	requestCountURL := fmt.Sprintf("%s/api/v1/libraries/%s/books/%s/return", libraryService, reservation.Library_uid, reservation.Book_uid)
 
-	reqCount, err := http.NewRequest(http.MethodPut, requestCountURL, nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Message: err.Error(),
-		})
-		return
-	}
-	reqCount.Header.Set("Authorization", authToken)
-
-	_, err = http.DefaultClient.Do(reqCount)
-	if err != nil {
-		job := jobqueue.NewExecJob(func() (any, error) {
-			return http.DefaultClient.Do(reqCount)
-		})
-		h.jobScheduler.JobQueue <- job
+	countJob := httpJob{Method: http.MethodPost, URL: requestCountURL, Username: reservation.Username, IdempotencyKey: "return:" + reservation.Reservation_uid}
+	if err = h.jobScheduler.Execute(c.Request.Context(), jobLibraryReturnBook, countJob); err != nil {
+		job, err := h.jobScheduler.Enqueue(jobLibraryReturnBook, countJob)
+		if err != nil {
+			fmt.Printf("failed to enqueue count update %s\n", err.Error())
+		} else {
+			fmt.Printf("count update for reservation %s deferred to job %s\n", reservation.Reservation_uid, job.ID)
+		}
 	}
 
 	//update rating
@@ -1068,24 +876,18 @@ func (h *Handler) ReturnBook(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
-	}
-
-	reqUpdRating, err := http.NewRequest(http.MethodPut, requestUpdRatingURL, bytes.NewReader(marshalled))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Message: err.Error(),
-		})
 		return
 	}
-	reqUpdRating.Header.Set("Authorization", authToken)
 
-	_, err = http.DefaultClient.Do(reqUpdRating)
-	if err != nil {
+	ratingJob := httpJob{Method: http.MethodPut, URL: requestUpdRatingURL, Username: reservation.Username, Body: marshalled, IdempotencyKey: "rating:" + reservation.Reservation_uid}
+	if err = h.jobScheduler.Execute(c.Request.Context(), jobRatingUpdate, ratingJob); err != nil {
 		c.Status(http.StatusNoContent)
-		job := jobqueue.NewExecJob(func() (any, error) {
-			return http.DefaultClient.Do(reqUpdRating)
-		})
-		h.jobScheduler.JobQueue <- job
+		job, err := h.jobScheduler.Enqueue(jobRatingUpdate, ratingJob)
+		if err != nil {
+			fmt.Printf("failed to enqueue rating update %s\n", err.Error())
+		} else {
+			fmt.Printf("rating update for reservation %s deferred to job %s\n", reservation.Reservation_uid, job.ID)
+		}
 		return
 	}
 
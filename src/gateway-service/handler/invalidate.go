@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"log"
+
+	"lab2/src/events"
+
+	"github.com/IBM/sarama"
+)
+
+// CatalogueInvalidator drops cached books and libraries when library-service
+// publishes a change. Every gateway instance consumes in its own group, so
+// each instance sees every event.
+type CatalogueInvalidator struct {
+	h *Handler
+}
+
+func (h *Handler) CatalogueInvalidator() *CatalogueInvalidator {
+	return &CatalogueInvalidator{h: h}
+}
+
+func (i *CatalogueInvalidator) Setup(_ sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (i *CatalogueInvalidator) Cleanup(_ sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (i *CatalogueInvalidator) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for message := range claim.Messages() {
+		event, err := events.Decode(message.Value)
+		if err != nil {
+			log.Printf("skipping kafka message at offset %d: %v", message.Offset, err)
+		} else {
+			i.h.invalidate(event)
+		}
+		session.MarkMessage(message, "")
+	}
+	return nil
+}
+
+func (h *Handler) invalidate(event events.Event) {
+	switch event.Type {
+	case events.BookUpdated, events.BookDeleted:
+		h.books.Delete(event.BookUid)
+	case events.LibraryUpdated, events.LibraryDeleted:
+		h.libraries.Delete(event.LibraryUid)
+	}
+}
@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"lab2/src/jobqueue"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sony/gobreaker"
+)
+
+const (
+	jobReservationCreate  = "reservation.create"
+	jobReservationCancel  = "reservation.cancel"
+	jobReservationConfirm = "reservation.confirm"
+	jobLibraryTakeBook    = "library.take_book"
+	jobLibraryReturnBook  = "library.return_book"
+	jobRatingUpdate       = "rating.update"
+)
+
+// httpJob is a request replayed by the job scheduler. IdempotencyKey is sent
+// as the Idempotency-Key header to endpoints that would otherwise apply a
+// repeated call twice.
+//
+// Jobs are sent with the gateway's service token on behalf of Username.
+// Authorization is only set for calls made within the reader's request and is
+// never persisted. Library stock changes must leave it empty: they are
+// accepted from the service token only.
+type httpJob struct {
+	Method         string          `json:"method"`
+	URL            string          `json:"url"`
+	Username       string          `json:"username,omitempty"`
+	Authorization  string          `json:"-"`
+	IdempotencyKey string          `json:"idempotencyKey,omitempty"`
+	Body           json.RawMessage `json:"body,omitempty"`
+}
+
+func (h *Handler) registerJobs(jobScheduler *jobqueue.JobScheduler) {
+	policy := jobqueue.DefaultRetryPolicy
+
+	jobScheduler.Register(jobReservationCreate, h.httpJobHandler(h.reservationCB, "Reservation Service unavailable"), policy)
+	jobScheduler.Register(jobReservationCancel, h.httpJobHandler(h.reservationCB, "Reservation Service unavailable"), policy)
+	jobScheduler.Register(jobReservationConfirm, h.httpJobHandler(h.reservationCB, "Reservation Service unavailable"), policy)
+	jobScheduler.Register(jobLibraryTakeBook, h.httpJobHandler(h.libraryCB, "Library Service unavailable"), policy)
+	jobScheduler.Register(jobLibraryReturnBook, h.httpJobHandler(h.libraryCB, "Library Service unavailable"), policy)
+	jobScheduler.Register(jobRatingUpdate, h.httpJobHandler(h.ratingCB, "Bonus Service unavailable"), policy)
+}
+
+// httpJobHandler replays an httpJob through cb. Rejections by the target
+// service (4xx) are permanent, everything else is retried.
+func (h *Handler) httpJobHandler(cb *gobreaker.CircuitBreaker, unavailable string) jobqueue.HandlerFunc {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var job httpJob
+		if err := json.Unmarshal(payload, &job); err != nil {
+			return jobqueue.Permanent(err)
+		}
+
+		_, err := h.sagaRequest(ctx, cb, job, unavailable)
+
+		var srvErr *serviceError
+		if errors.As(err, &srvErr) && srvErr.status >= http.StatusBadRequest && srvErr.status < http.StatusInternalServerError {
+			return jobqueue.Permanent(err)
+		}
+
+		return err
+	}
+}
+
+type JobResponse struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Status    string          `json:"status"`
+	Attempts  int             `json:"attempts"`
+	NextRunAt string          `json:"nextRunAt"`
+	LastError string          `json:"lastError,omitempty"`
+	CreatedAt string          `json:"createdAt"`
+	UpdatedAt string          `json:"updatedAt"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+func JobToResponse(job *jobqueue.Job) JobResponse {
+	return JobResponse{
+		ID:        job.ID,
+		Type:      job.Type,
+		Status:    job.Status,
+		Attempts:  job.Attempts,
+		NextRunAt: job.NextRunAt.Format(time.RFC3339),
+		LastError: job.LastError,
+		CreatedAt: job.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: job.UpdatedAt.Format(time.RFC3339),
+		Payload:   job.Payload,
+	}
+}
+
+func JobsToResponse(jobs []*jobqueue.Job) []JobResponse {
+	res := make([]JobResponse, len(jobs))
+
+	for index, value := range jobs {
+		res[index] = JobToResponse(value)
+	}
+
+	return res
+}
+
+func (h *Handler) GetJobs(c *gin.Context) {
+	filter := jobqueue.Filter{
+		Status: c.Query("status"),
+		Type:   c.Query("type"),
+		Limit:  100,
+	}
+
+	switch filter.Status {
+	case "", jobqueue.StatusPending, jobqueue.StatusRunning, jobqueue.StatusSucceeded, jobqueue.StatusDead:
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: "unknown job status",
+		})
+		return
+	}
+
+	if limitParam := c.Query("limit"); limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Message: "invalid limit",
+			})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	jobs, err := h.jobScheduler.Jobs(context.Background(), filter)
+	if err != nil {
+		fmt.Printf("failed to get jobs %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, JobsToResponse(jobs))
+}
+
+func (h *Handler) GetJob(c *gin.Context) {
+	job, err := h.jobScheduler.Job(context.Background(), c.Param("id"))
+	if err != nil {
+		h.jobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, JobToResponse(job))
+}
+
+func (h *Handler) GetDeadJobs(c *gin.Context) {
+	jobs, err := h.jobScheduler.DeadJobs(context.Background())
+	if err != nil {
+		fmt.Printf("failed to get dead jobs %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, JobsToResponse(jobs))
+}
+
+func (h *Handler) ReplayDeadJob(c *gin.Context) {
+	job, err := h.jobScheduler.Replay(context.Background(), c.Param("id"))
+	if err != nil {
+		h.jobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, JobToResponse(job))
+}
+
+func (h *Handler) DiscardDeadJob(c *gin.Context) {
+	if err := h.jobScheduler.Discard(context.Background(), c.Param("id")); err != nil {
+		h.jobError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) jobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, jobqueue.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Message: err.Error()})
+	case errors.Is(err, jobqueue.ErrJobNotDead):
+		c.JSON(http.StatusConflict, ErrorResponse{Message: err.Error()})
+	default:
+		fmt.Printf("job operation failed %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+}
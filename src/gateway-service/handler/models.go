@@ -1,10 +1,18 @@
 package handler
 
+import "time"
+
 const (
 	ratingService      string = "http://rating-service:8050"
 	libraryService     string = "http://library-service:8060"
 	reservationService string = "http://reservation-service:8070"
 	statisticsService  string = "http://statistics-service:8040"
+	idpInternalService string = "http://idp-service:8091"
+)
+
+const (
+	catalogueCacheSize = 10000
+	catalogueCacheTTL  = 10 * time.Minute
 )
 
 type ErrorResponse struct {
@@ -26,6 +34,7 @@ type LibrariesLimited struct {
 	Page          int               `json:"page"`
 	PageSize      int               `json:"pageSize"`
 	TotalElements int               `json:"totalElements"`
+	TotalPages    int               `json:"totalPages"`
 	Items         []LibraryResponse `json:"items"`
 }
 
@@ -49,6 +58,7 @@ type BookLimited struct {
 	Page          int            `json:"page"`
 	PageSize      int            `json:"pageSize"`
 	TotalElements int            `json:"totalElements"`
+	TotalPages    int            `json:"totalPages"`
 	Items         []BookResponse `json:"items"`
 }
 
@@ -90,15 +100,26 @@ type TakeBookResponse struct {
 	Rating          RatingResponse     `json:"rating"`
 }
 
+// PendingReservationResponse is returned when the reservation saga could not
+// finish within the request and goes on in the background.
+type PendingReservationResponse struct {
+	Reservation_uid string `json:"reservationUid"`
+	Saga_id         string `json:"sagaId"`
+	Status          string `json:"status,omitempty"`
+	Message         string `json:"message"`
+}
+
 type CreateReservationRequest struct {
-	BookUid    string `json:"bookUid"`
-	LibraryUid string `json:"libraryUid"`
-	TillDate   string `json:"tillDate"`
+	ReservationUid string `json:"reservationUid,omitempty"`
+	BookUid        string `json:"bookUid"`
+	LibraryUid     string `json:"libraryUid"`
+	TillDate       string `json:"tillDate"`
 }
 
 type UpdateReservationRequest struct {
 	Condition string `json:"condition"`
-	Date      string `json:"date"`
+	//part of the API, ignored: returns are dated by reservation-service
+	Date string `json:"date"`
 }
 
 type ReservationAmount struct {
@@ -115,6 +136,30 @@ type ReservationsResponse struct {
 	Username        Username           `json:"username"`
 }
 
+type ReservationsPage struct {
+	Page          int                   `json:"page"`
+	PageSize      int                   `json:"pageSize"`
+	TotalElements int                   `json:"totalElements"`
+	TotalPages    int                   `json:"totalPages"`
+	Items         []ReservationResponse `json:"items"`
+}
+
+type ReservationsLimited struct {
+	Page          int                         `json:"page"`
+	PageSize      int                         `json:"pageSize"`
+	TotalElements int                         `json:"totalElements"`
+	TotalPages    int                         `json:"totalPages"`
+	Items         []ReservationToUserResponse `json:"items"`
+}
+
+type AllReservationsLimited struct {
+	Page          int                    `json:"page"`
+	PageSize      int                    `json:"pageSize"`
+	TotalElements int                    `json:"totalElements"`
+	TotalPages    int                    `json:"totalPages"`
+	Items         []ReservationsResponse `json:"items"`
+}
+
 type Username struct {
 	Name string `json:"name"`
 }
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"lab2/src/gateway-service/saga"
+	"lab2/src/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sony/gobreaker"
+)
+
+// serviceError is a definite failure of a service call. body keeps a 4xx
+// response so that field-level errors reach the client unchanged.
+type serviceError struct {
+	status  int
+	message string
+	body    []byte
+}
+
+func (e *serviceError) Error() string {
+	return e.message
+}
+
+// sagaRequest performs a single saga step call. Requests rejected by the
+// circuit breaker and 4xx responses are definite failures, while transport
+// errors and 5xx responses leave the outcome unknown and are reported as
+// saga.ErrAmbiguous.
+func (h *Handler) sagaRequest(ctx context.Context, cb *gobreaker.CircuitBreaker, job httpJob, unavailable string) ([]byte, error) {
+	method, url := job.Method, job.URL
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(job.Body))
+	if err != nil {
+		return nil, &serviceError{status: http.StatusInternalServerError, message: err.Error()}
+	}
+	if job.Authorization != "" {
+		req.Header.Set("Authorization", job.Authorization)
+	} else {
+		authorization, err := h.credentials.authorization(ctx)
+		if err != nil {
+			fmt.Printf("failed to get service token %s\n", err.Error())
+			return nil, &serviceError{status: http.StatusServiceUnavailable, message: "Identity Provider unavailable"}
+		}
+		req.Header.Set("Authorization", authorization)
+		req.Header.Set(middleware.ActingUserHeader, job.Username)
+	}
+	if job.IdempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", job.IdempotencyKey)
+	}
+
+	ires, err := cb.Execute(func() (any, error) {
+		return http.DefaultClient.Do(req)
+	})
+	if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+		return nil, &serviceError{status: http.StatusServiceUnavailable, message: unavailable}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", saga.ErrAmbiguous, err.Error())
+	}
+
+	res, ok := ires.(*http.Response)
+	if !ok {
+		return nil, &serviceError{status: http.StatusInternalServerError, message: "unexpected response"}
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", saga.ErrAmbiguous, err.Error())
+	}
+
+	if res.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("%w: %s %s: %d", saga.ErrAmbiguous, method, url, res.StatusCode)
+	}
+
+	if res.StatusCode >= http.StatusBadRequest {
+		var errRes ErrorResponse
+		if err := json.Unmarshal(resBody, &errRes); err != nil || errRes.Message == "" {
+			errRes.Message = fmt.Sprintf("%s %s: %d", method, url, res.StatusCode)
+		}
+		return nil, &serviceError{status: res.StatusCode, message: errRes.Message, body: resBody}
+	}
+
+	return resBody, nil
+}
+
+// SagaResponse leaves out the step commands, which carry request payloads.
+type SagaResponse struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Status    string            `json:"status"`
+	Current   int               `json:"current"`
+	Steps     []saga.StepRecord `json:"steps"`
+	Error     string            `json:"error,omitempty"`
+	CreatedAt string            `json:"createdAt"`
+	UpdatedAt string            `json:"updatedAt"`
+}
+
+func SagaToResponse(s *saga.Saga) SagaResponse {
+	return SagaResponse{
+		ID:        s.ID,
+		Name:      s.Name,
+		Status:    s.Status,
+		Current:   s.Current,
+		Steps:     s.Records,
+		Error:     s.Error,
+		CreatedAt: s.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: s.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func SagasToResponse(sagas []*saga.Saga) []SagaResponse {
+	res := make([]SagaResponse, len(sagas))
+
+	for index, value := range sagas {
+		res[index] = SagaToResponse(value)
+	}
+
+	return res
+}
+
+func (h *Handler) GetSagas(c *gin.Context) {
+	filter := saga.Filter{
+		Status: c.Query("status"),
+		Name:   c.Query("name"),
+		Limit:  100,
+	}
+
+	switch filter.Status {
+	case "", saga.StatusRunning, saga.StatusPending, saga.StatusCompleted, saga.StatusFailed:
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: "unknown saga status",
+		})
+		return
+	}
+
+	if limitParam := c.Query("limit"); limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Message: "invalid limit",
+			})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	sagas, err := h.orchestrator.Sagas(context.Background(), filter)
+	if err != nil {
+		fmt.Printf("failed to get sagas %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, SagasToResponse(sagas))
+}
+
+func (h *Handler) GetSaga(c *gin.Context) {
+	s, err := h.orchestrator.Saga(context.Background(), c.Param("id"))
+	if errors.Is(err, saga.ErrSagaNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Message: err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Printf("failed to get saga %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, SagaToResponse(s))
+}
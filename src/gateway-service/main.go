@@ -1,11 +1,26 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"lab2/src/events"
 	"lab2/src/gateway-service/handler"
+	"lab2/src/gateway-service/saga"
 	"lab2/src/jobqueue"
+	"lab2/src/kafka"
 	"lab2/src/middleware"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/IBM/sarama"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/sony/gobreaker"
@@ -23,10 +38,82 @@ func main() {
 	st.Name = "Reservation Circuit Breaker"
 	reservationCb := gobreaker.NewCircuitBreaker(st)
 
-	jobScheduler := jobqueue.NewJobScheduler(10 * time.Second)
+	var jobStore jobqueue.Store
+	var sagaStore saga.Store
+	if path := os.Getenv("JOBQUEUE_FILE"); path != "" {
+		fileStore, err := jobqueue.NewFileStore(path)
+		if err != nil {
+			log.Fatalf("job queue file store init: %s", err)
+		}
+		jobStore = fileStore
+
+		sagaFileStore, err := saga.NewFileStore(strings.TrimSuffix(path, filepath.Ext(path)) + "-sagas.json")
+		if err != nil {
+			log.Fatalf("saga file store init: %s", err)
+		}
+		sagaStore = sagaFileStore
+	} else {
+		postgresURL := fmt.Sprintf("host=%s port=%d user=%s dbname=%s password=%s",
+			"postgres", 5432, "program", "gateway", "test")
+		pgStore, err := jobqueue.NewPgStore(context.Background(), postgresURL)
+		if err != nil {
+			log.Fatalf("job queue postgres store init: %s", err)
+		}
+		defer pgStore.Close()
+		jobStore = pgStore
+
+		sagaPgStore, err := saga.NewPgStore(context.Background(), postgresURL)
+		if err != nil {
+			log.Fatalf("saga postgres store init: %s", err)
+		}
+		defer sagaPgStore.Close()
+		sagaStore = sagaPgStore
+	}
+
+	jobScheduler := jobqueue.NewJobScheduler(jobStore, 10*time.Second)
+	if workers, err := strconv.Atoi(os.Getenv("JOBQUEUE_WORKERS")); err == nil && workers > 0 {
+		jobScheduler.Workers = workers
+	}
+
+	clientSecret := os.Getenv("GATEWAY_CLIENT_SECRET")
+	if clientSecret == "" {
+		log.Fatal("GATEWAY_CLIENT_SECRET is not set")
+	}
+
+	handler := handler.NewHandler(libraryCb, ratingCb, reservationCb, jobScheduler, sagaStore, clientSecret)
+
 	jobScheduler.Start()
 
-	handler := handler.NewHandler(libraryCb, ratingCb, reservationCb, jobScheduler)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	//the catalogue cache is per instance, so is the group invalidating it
+	go func() {
+		hostname, _ := os.Hostname()
+		consumerGroup, err := kafka.NewConsumerGroup([]string{"kafka:9092"}, "gateway-cache-"+hostname, sarama.OffsetNewest)
+		if err != nil {
+			log.Printf("catalogue cache invalidation disabled: %s", err)
+			return
+		}
+		defer consumerGroup.Close()
+
+		go func() {
+			for err := range consumerGroup.Errors() {
+				log.Printf("consumer group error: %v", err)
+			}
+		}()
+
+		for {
+			if err := consumerGroup.Consume(ctx, []string{events.Topic}, handler.CatalogueInvalidator()); err != nil {
+				log.Printf("error consuming kafka topic: %v", err)
+				time.Sleep(time.Second)
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}()
 
 	router := gin.Default()
 
@@ -42,16 +129,74 @@ func main() {
 
 	router.GET("/api/v1/libraries", handler.GetLibrariesByCity)
 	router.GET("/api/v1/libraries/:uid/books/", handler.GetBooksByLibraryUid)
+	router.GET("/api/v1/books/search", handler.ProxyCatalogue)
 
 	router.GET("/api/v1/rating/", jwtMiddleware.Middleware(), handler.GetRating)
 	router.GET("/api/v1/reservations", jwtMiddleware.Middleware(), handler.GetReservations)
-	router.GET("/api/v1/reservations/all", jwtMiddleware.Middleware(), handler.GetReservationsAll)
+	router.GET("/api/v1/reservations/all", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.GetReservationsAll)
+	router.GET("/api/v1/reservations/overdue", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.GetReservationsOverdue)
 	router.POST("/api/v1/reservations", jwtMiddleware.Middleware(), handler.CreateReservation)
 	router.POST("/api/v1/reservations/:uid/return", jwtMiddleware.Middleware(), handler.ReturnBook)
-
-	router.GET("/api/v1/statistics", jwtMiddleware.Middleware(), handler.Stats)
+	router.POST("/api/v1/reservations/:uid/renew", jwtMiddleware.Middleware(), handler.ProxyReservation)
+	router.POST("/api/v1/reservations/:uid/cancel", jwtMiddleware.Middleware(), handler.CancelReservation)
+	router.PUT("/api/v1/reservations/:uid/status", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.ProxyReservation)
+
+	router.GET("/api/v1/holds", jwtMiddleware.Middleware(), handler.ProxyReservation)
+	router.POST("/api/v1/holds", jwtMiddleware.Middleware(), handler.ProxyReservation)
+	router.DELETE("/api/v1/holds/:uid", jwtMiddleware.Middleware(), handler.ProxyReservation)
+
+	router.GET("/api/v1/fines", jwtMiddleware.Middleware(), handler.ProxyReservation)
+	router.GET("/api/v1/fines/debtors", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.ProxyReservation)
+	router.GET("/api/v1/fines/users/:username", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.ProxyReservation)
+	router.POST("/api/v1/fines/users/:username/payments", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.ProxyReservation)
+	router.POST("/api/v1/fines/users/:username/waivers", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.ProxyReservation)
+
+	router.GET("/api/v1/statistics", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.Stats)
+
+	router.POST("/api/v1/libraries", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.ProxyCatalogue)
+	router.PUT("/api/v1/libraries/:uid", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.ProxyCatalogue)
+	router.DELETE("/api/v1/libraries/:uid", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.ProxyCatalogue)
+	router.POST("/api/v1/books", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.ProxyCatalogue)
+	router.PUT("/api/v1/books/:uid", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.ProxyCatalogue)
+	router.DELETE("/api/v1/books/:uid", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.ProxyCatalogue)
+	router.PUT("/api/v1/libraries/:uid/books/:bookUid", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.ProxyCatalogue)
+	router.POST("/api/v1/libraries/:uid/books/:bookUid/copies", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.ProxyCatalogue)
+	router.DELETE("/api/v1/libraries/:uid/books/:bookUid", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.ProxyCatalogue)
+
+	router.GET("/api/v1/admin/jobs", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.GetJobs)
+	router.GET("/api/v1/admin/jobs/:id", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.GetJob)
+	router.GET("/api/v1/admin/dead-jobs", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.GetDeadJobs)
+	router.POST("/api/v1/admin/dead-jobs/:id/replay", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.ReplayDeadJob)
+	router.DELETE("/api/v1/admin/dead-jobs/:id", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.DiscardDeadJob)
+	router.GET("/api/v1/admin/sagas", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.GetSagas)
+	router.GET("/api/v1/admin/sagas/:id", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.GetSaga)
 
 	router.GET("/manage/health", handler.GetHealth)
 
-	router.Run()
+	srv := &http.Server{
+		Addr:    ":8080",
+		Handler: router,
+	}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("listen: %s", err)
+		}
+	}()
+
+	<-ctx.Done()
+
+	log.Println("Shutting down gateway")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server shutdown: %s", err)
+	}
+
+	//jobs enqueued by the last requests are drained after the server stops
+	if err := jobScheduler.Stop(shutdownCtx); err != nil {
+		log.Printf("job scheduler stop: %s", err)
+	}
 }
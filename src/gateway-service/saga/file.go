@@ -0,0 +1,150 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// FileStore keeps sagas in a single JSON file. It is meant for local runs
+// without a database, next to the job queue FileStore.
+type FileStore struct {
+	path  string
+	mu    sync.Mutex
+	sagas map[string]*Saga
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	fs := &FileStore{
+		path:  path,
+		sagas: make(map[string]*Saga),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read saga file: %w", err)
+	}
+
+	var sagas []*Saga
+	if err := json.Unmarshal(data, &sagas); err != nil {
+		return nil, fmt.Errorf("unable to decode saga file: %w", err)
+	}
+
+	for _, s := range sagas {
+		fs.sagas[s.ID] = s
+	}
+
+	return fs, nil
+}
+
+func (fs *FileStore) Save(_ context.Context, s *Saga) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	saved, err := clone(s)
+	if err != nil {
+		return err
+	}
+	fs.sagas[s.ID] = saved
+
+	return fs.flush()
+}
+
+func (fs *FileStore) Get(_ context.Context, id string) (*Saga, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	s, ok := fs.sagas[id]
+	if !ok {
+		return nil, ErrSagaNotFound
+	}
+
+	return clone(s)
+}
+
+func (fs *FileStore) List(_ context.Context, filter Filter) ([]*Saga, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	sagas := make([]*Saga, 0)
+	for _, s := range fs.sorted() {
+		if filter.Status != "" && s.Status != filter.Status {
+			continue
+		}
+		if filter.Name != "" && s.Name != filter.Name {
+			continue
+		}
+
+		copied, err := clone(s)
+		if err != nil {
+			return nil, err
+		}
+
+		sagas = append(sagas, copied)
+		if filter.Limit > 0 && len(sagas) == filter.Limit {
+			break
+		}
+	}
+
+	return sagas, nil
+}
+
+// sorted returns the sagas newest first.
+func (fs *FileStore) sorted() []*Saga {
+	sagas := make([]*Saga, 0, len(fs.sagas))
+	for _, s := range fs.sagas {
+		sagas = append(sagas, s)
+	}
+
+	sort.Slice(sagas, func(i, j int) bool {
+		return sagas[i].CreatedAt.After(sagas[j].CreatedAt)
+	})
+
+	return sagas
+}
+
+// clone deep copies a saga through JSON, the form it is resumed from.
+func clone(s *Saga) (*Saga, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode saga: %w", err)
+	}
+
+	var copied Saga
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return nil, fmt.Errorf("unable to decode saga: %w", err)
+	}
+
+	return &copied, nil
+}
+
+func (fs *FileStore) flush() error {
+	data, err := json.MarshalIndent(fs.sorted(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode sagas: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(fs.path), filepath.Base(fs.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("unable to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write sagas: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to close temp file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), fs.path)
+}
@@ -0,0 +1,88 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const sagaColumns = `id, name, status, current, steps, records, error, created_at, updated_at`
+
+type PgStore struct {
+	db *pgxpool.Pool
+}
+
+func NewPgStore(ctx context.Context, connString string) (*PgStore, error) {
+	db, err := pgxpool.New(ctx, connString)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create connection pool: %w", err)
+	}
+
+	return &PgStore{db: db}, nil
+}
+
+func (ps *PgStore) Close() {
+	ps.db.Close()
+}
+
+func (ps *PgStore) Save(ctx context.Context, s *Saga) error {
+	query := `INSERT INTO sagas (` + sagaColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (id) DO UPDATE SET status = EXCLUDED.status, current = EXCLUDED.current,
+	records = EXCLUDED.records, error = EXCLUDED.error, updated_at = EXCLUDED.updated_at`
+
+	_, err := ps.db.Exec(ctx, query, s.ID, s.Name, s.Status, s.Current, s.Steps, s.Records,
+		s.Error, s.CreatedAt, s.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("unable to save saga: %w", err)
+	}
+
+	return nil
+}
+
+func (ps *PgStore) Get(ctx context.Context, id string) (*Saga, error) {
+	rows, err := ps.db.Query(ctx, `SELECT `+sagaColumns+` FROM sagas WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query: %w", err)
+	}
+	defer rows.Close()
+
+	s, err := pgx.CollectOneRow(rows, scanSaga)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSagaNotFound
+	}
+
+	return s, err
+}
+
+func (ps *PgStore) List(ctx context.Context, filter Filter) ([]*Saga, error) {
+	query := `SELECT ` + sagaColumns + ` FROM sagas
+	WHERE ($1 = '' OR status = $1) AND ($2 = '' OR name = $2)
+	ORDER BY created_at DESC`
+	args := []any{filter.Status, filter.Name}
+
+	if filter.Limit > 0 {
+		query += ` LIMIT $3`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := ps.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query: %w", err)
+	}
+	defer rows.Close()
+
+	return pgx.CollectRows(rows, scanSaga)
+}
+
+func scanSaga(row pgx.CollectableRow) (*Saga, error) {
+	var s Saga
+
+	err := row.Scan(&s.ID, &s.Name, &s.Status, &s.Current, &s.Steps, &s.Records,
+		&s.Error, &s.CreatedAt, &s.UpdatedAt)
+
+	return &s, err
+}
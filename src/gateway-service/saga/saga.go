@@ -0,0 +1,307 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"lab2/src/jobqueue"
+
+	"github.com/google/uuid"
+)
+
+// ErrAmbiguous marks a step whose outcome is unknown, e.g. the request was
+// sent but the response was lost. The saga stops at such a step and is
+// resumed from it by the job scheduler, so step commands must be safe to
+// repeat. If the resume job is dead-lettered, the step counts as failed.
+var ErrAmbiguous = errors.New("ambiguous step outcome")
+
+// ErrPending is returned by Run when the saga stopped at an ambiguous step
+// and was left to the job scheduler to finish.
+var ErrPending = errors.New("saga is pending")
+
+var ErrSagaNotFound = errors.New("saga not found")
+
+const jobResume = "saga.resume"
+
+type StepStatus string
+
+const (
+	StepPending               StepStatus = "PENDING"
+	StepDone                  StepStatus = "DONE"
+	StepFailed                StepStatus = "FAILED"
+	StepRetrying              StepStatus = "RETRYING"
+	StepCompensated           StepStatus = "COMPENSATED"
+	StepCompensationScheduled StepStatus = "COMPENSATION_SCHEDULED"
+)
+
+// Saga statuses. A RUNNING saga is being executed by a request, a PENDING one
+// waits for the job scheduler to resume it; COMPLETED and FAILED are final.
+const (
+	StatusRunning   = "RUNNING"
+	StatusPending   = "PENDING"
+	StatusCompleted = "COMPLETED"
+	StatusFailed    = "FAILED"
+)
+
+// Command is a serializable call executed by the job scheduler handler
+// registered for Type. Commands are run inline first and enqueued as jobs
+// when they need to be retried.
+type Command struct {
+	Type    string `json:"type"`
+	Payload any    `json:"payload"`
+}
+
+type Step struct {
+	Name       string   `json:"name"`
+	Action     Command  `json:"action"`
+	Compensate *Command `json:"compensate,omitempty"`
+}
+
+type StepRecord struct {
+	Name      string     `json:"name"`
+	Status    StepStatus `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	JobID     string     `json:"jobId,omitempty"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// Saga is persisted after every step, so that a pending saga can be resumed
+// from Current by another process.
+type Saga struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	Status    string       `json:"status"`
+	Current   int          `json:"current"`
+	Steps     []Step       `json:"steps"`
+	Records   []StepRecord `json:"records"`
+	Error     string       `json:"error,omitempty"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+}
+
+// Filter narrows List results; empty fields match every saga.
+type Filter struct {
+	Status string
+	Name   string
+	Limit  int
+}
+
+type Store interface {
+	Save(ctx context.Context, s *Saga) error
+	Get(ctx context.Context, id string) (*Saga, error)
+	List(ctx context.Context, filter Filter) ([]*Saga, error)
+}
+
+type resumeJob struct {
+	SagaID string `json:"sagaId"`
+}
+
+type Orchestrator struct {
+	jobScheduler *jobqueue.JobScheduler
+	store        Store
+}
+
+// NewOrchestrator registers the job resuming pending sagas with jobScheduler.
+func NewOrchestrator(jobScheduler *jobqueue.JobScheduler, store Store) *Orchestrator {
+	o := &Orchestrator{jobScheduler: jobScheduler, store: store}
+	jobScheduler.Register(jobResume, o.resume, jobqueue.DefaultRetryPolicy)
+	jobScheduler.OnDead(jobResume, o.abandon)
+
+	return o
+}
+
+func (o *Orchestrator) New(name string, steps ...Step) *Saga {
+	now := time.Now().UTC()
+
+	records := make([]StepRecord, len(steps))
+	for i, step := range steps {
+		records[i] = StepRecord{Name: step.Name, Status: StepPending, UpdatedAt: now}
+	}
+
+	return &Saga{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Status:    StatusRunning,
+		Steps:     steps,
+		Records:   records,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// Run executes the saga steps in order. When a step fails, the already
+// completed steps are compensated in reverse order and the step error is
+// returned. Compensations that fail are handed to the job scheduler and
+// retried there; the scheduled job ID is kept in the step record.
+//
+// A step with an ambiguous outcome stops the saga: it is saved as PENDING,
+// a job resuming it from that step is enqueued and ErrPending is returned.
+// When that job runs out of attempts or time, the saga is failed as if the
+// step had failed.
+func (o *Orchestrator) Run(ctx context.Context, s *Saga) error {
+	if err := o.store.Save(ctx, s); err != nil {
+		return fmt.Errorf("saga %s: %w", s.Name, err)
+	}
+
+	err := o.advance(ctx, s)
+	if !errors.Is(err, ErrPending) {
+		return err
+	}
+
+	job, enqueueErr := o.jobScheduler.Enqueue(jobResume, resumeJob{SagaID: s.ID})
+	if enqueueErr != nil {
+		fmt.Printf("saga %s (%s): failed to schedule resume: %s\n", s.Name, s.ID, enqueueErr.Error())
+		return err
+	}
+
+	s.Records[s.Current].JobID = job.ID
+	o.save(ctx, s)
+
+	return err
+}
+
+// resume continues a pending saga. The job is retried while the current step
+// stays ambiguous and succeeds once the saga reached a final status.
+func (o *Orchestrator) resume(ctx context.Context, payload json.RawMessage) error {
+	var job resumeJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return jobqueue.Permanent(err)
+	}
+
+	s, err := o.store.Get(ctx, job.SagaID)
+	if errors.Is(err, ErrSagaNotFound) {
+		return jobqueue.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.Status != StatusRunning && s.Status != StatusPending {
+		return nil
+	}
+
+	err = o.advance(ctx, s)
+	if errors.Is(err, ErrPending) {
+		return err
+	}
+
+	return nil
+}
+
+// abandon fails a pending saga whose resume job was dead-lettered: the steps
+// before the ambiguous one are compensated, the same way as after a failure.
+func (o *Orchestrator) abandon(ctx context.Context, payload json.RawMessage, err error) {
+	var job resumeJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		fmt.Printf("failed to decode saga resume job %s\n", err.Error())
+		return
+	}
+
+	s, getErr := o.store.Get(ctx, job.SagaID)
+	if getErr != nil {
+		fmt.Printf("saga %s: failed to load abandoned saga: %s\n", job.SagaID, getErr.Error())
+		return
+	}
+
+	if s.Status != StatusRunning && s.Status != StatusPending {
+		return
+	}
+
+	i := s.Current
+	s.record(i, StepFailed, err)
+	o.compensate(ctx, s, i-1)
+	s.Status = StatusFailed
+	s.Error = err.Error()
+	o.save(ctx, s)
+}
+
+func (o *Orchestrator) advance(ctx context.Context, s *Saga) error {
+	for s.Current < len(s.Steps) {
+		i := s.Current
+		step := s.Steps[i]
+
+		err := o.jobScheduler.Execute(ctx, step.Action.Type, step.Action.Payload)
+		if err == nil {
+			s.record(i, StepDone, nil)
+			s.Current++
+			s.Status = StatusRunning
+			o.save(ctx, s)
+			continue
+		}
+
+		if errors.Is(err, ErrAmbiguous) {
+			s.record(i, StepRetrying, err)
+			s.Status = StatusPending
+			o.save(ctx, s)
+
+			return fmt.Errorf("saga %s: step %s: %w: %s", s.Name, step.Name, ErrPending, err.Error())
+		}
+
+		s.record(i, StepFailed, err)
+		o.compensate(ctx, s, i-1)
+		s.Status = StatusFailed
+		s.Error = err.Error()
+		o.save(ctx, s)
+
+		return fmt.Errorf("saga %s: step %s: %w", s.Name, step.Name, err)
+	}
+
+	s.Status = StatusCompleted
+	o.save(ctx, s)
+
+	return nil
+}
+
+func (o *Orchestrator) compensate(ctx context.Context, s *Saga, from int) {
+	for i := from; i >= 0; i-- {
+		step := s.Steps[i]
+		if step.Compensate == nil {
+			continue
+		}
+
+		err := o.jobScheduler.Execute(ctx, step.Compensate.Type, step.Compensate.Payload)
+		if err == nil {
+			s.record(i, StepCompensated, nil)
+			continue
+		}
+
+		s.record(i, StepCompensationScheduled, err)
+
+		job, err := o.jobScheduler.Enqueue(step.Compensate.Type, step.Compensate.Payload)
+		if err != nil {
+			fmt.Printf("saga %s (%s): failed to schedule compensation of %s: %s\n", s.Name, s.ID, step.Name, err.Error())
+			continue
+		}
+		s.Records[i].JobID = job.ID
+	}
+}
+
+// save persists the saga. A failed save is only logged: steps are safe to
+// repeat, so resuming from an older state is harmless.
+func (o *Orchestrator) save(ctx context.Context, s *Saga) {
+	s.UpdatedAt = time.Now().UTC()
+
+	if err := o.store.Save(ctx, s); err != nil {
+		fmt.Printf("saga %s (%s): failed to save: %s\n", s.Name, s.ID, err.Error())
+	}
+}
+
+func (o *Orchestrator) Sagas(ctx context.Context, filter Filter) ([]*Saga, error) {
+	return o.store.List(ctx, filter)
+}
+
+func (o *Orchestrator) Saga(ctx context.Context, id string) (*Saga, error) {
+	return o.store.Get(ctx, id)
+}
+
+func (s *Saga) record(i int, status StepStatus, err error) {
+	s.Records[i].Status = status
+	s.Records[i].Error = ""
+	if err != nil {
+		s.Records[i].Error = err.Error()
+	}
+	s.Records[i].UpdatedAt = time.Now().UTC()
+}
@@ -0,0 +1,184 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lab2/src/jobqueue"
+)
+
+type fixture struct {
+	orchestrator *Orchestrator
+	scheduler    *jobqueue.JobScheduler
+	jobs         *jobqueue.FileStore
+	calls        []string
+	results      map[string]error
+}
+
+// newFixture registers step types a, b and c whose outcome is taken from
+// results; compensations of a step are registered as undo.<type>.
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	dir := t.TempDir()
+	jobs, err := jobqueue.NewFileStore(filepath.Join(dir, "jobs.json"))
+	if err != nil {
+		t.Fatalf("jobqueue.NewFileStore: %v", err)
+	}
+	sagas, err := NewFileStore(filepath.Join(dir, "sagas.json"))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+
+	f := &fixture{jobs: jobs, results: make(map[string]error)}
+	scheduler := jobqueue.NewJobScheduler(jobs, time.Minute)
+	for _, jobType := range []string{"a", "b", "c", "undo.a", "undo.b"} {
+		jobType := jobType
+		scheduler.Register(jobType, func(ctx context.Context, payload json.RawMessage) error {
+			f.calls = append(f.calls, jobType)
+			return f.results[jobType]
+		}, jobqueue.DefaultRetryPolicy)
+	}
+	f.scheduler = scheduler
+	f.orchestrator = NewOrchestrator(scheduler, sagas)
+
+	return f
+}
+
+func (f *fixture) saga() *Saga {
+	return f.orchestrator.New("test",
+		Step{Name: "a", Action: Command{Type: "a"}, Compensate: &Command{Type: "undo.a"}},
+		Step{Name: "b", Action: Command{Type: "b"}, Compensate: &Command{Type: "undo.b"}},
+		Step{Name: "c", Action: Command{Type: "c"}},
+	)
+}
+
+func TestAmbiguousStepStopsSaga(t *testing.T) {
+	f := newFixture(t)
+	f.results["b"] = ErrAmbiguous
+
+	s := f.saga()
+	if err := f.orchestrator.Run(context.Background(), s); !errors.Is(err, ErrPending) {
+		t.Fatalf("expected ErrPending, got %v", err)
+	}
+
+	if len(f.calls) != 2 || f.calls[1] != "b" {
+		t.Fatalf("saga went past the ambiguous step: %v", f.calls)
+	}
+
+	stored, err := f.orchestrator.Saga(context.Background(), s.ID)
+	if err != nil {
+		t.Fatalf("Saga: %v", err)
+	}
+	if stored.Status != StatusPending || stored.Current != 1 || stored.Records[1].Status != StepRetrying {
+		t.Fatalf("pending saga not persisted: %+v", stored)
+	}
+
+	jobs, _ := f.jobs.List(context.Background(), jobqueue.Filter{Type: jobResume})
+	if len(jobs) != 1 || stored.Records[1].JobID != jobs[0].ID {
+		t.Fatalf("resume job not scheduled: %+v", jobs)
+	}
+
+	//the resume job keeps failing while the step stays ambiguous
+	if err := f.orchestrator.resume(context.Background(), jobs[0].Payload); !errors.Is(err, ErrPending) {
+		t.Fatalf("expected resume to be retried, got %v", err)
+	}
+
+	f.results["b"] = nil
+	if err := f.orchestrator.resume(context.Background(), jobs[0].Payload); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+
+	stored, _ = f.orchestrator.Saga(context.Background(), s.ID)
+	if stored.Status != StatusCompleted || f.calls[len(f.calls)-1] != "c" {
+		t.Fatalf("saga not finished by resume: %+v, calls %v", stored, f.calls)
+	}
+}
+
+func TestDeadResumeJobFailsSaga(t *testing.T) {
+	f := newFixture(t)
+	f.results["b"] = ErrAmbiguous
+
+	s := f.saga()
+	if err := f.orchestrator.Run(context.Background(), s); !errors.Is(err, ErrPending) {
+		t.Fatalf("expected ErrPending, got %v", err)
+	}
+
+	//the resume job has a single attempt left
+	jobs, _ := f.jobs.List(context.Background(), jobqueue.Filter{Type: jobResume})
+	if len(jobs) != 1 {
+		t.Fatalf("resume job not scheduled: %+v", jobs)
+	}
+	jobs[0].Policy.MaxAttempts = 1
+	if err := f.jobs.Save(context.Background(), jobs[0]); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	f.scheduler.Start()
+
+	var stored *Saga
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		stored, _ = f.orchestrator.Saga(context.Background(), s.ID)
+		if stored.Status != StatusPending {
+			break
+		}
+	}
+
+	if err := f.scheduler.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	if stored.Status != StatusFailed || stored.Records[0].Status != StepCompensated || stored.Records[1].Status != StepFailed {
+		t.Fatalf("abandoned saga not failed: %+v", stored)
+	}
+	if f.calls[len(f.calls)-1] != "undo.a" {
+		t.Fatalf("completed step not compensated: %v", f.calls)
+	}
+}
+
+func TestFailedStepCompensates(t *testing.T) {
+	f := newFixture(t)
+	f.results["c"] = errors.New("rejected")
+
+	s := f.saga()
+	err := f.orchestrator.Run(context.Background(), s)
+	if err == nil || errors.Is(err, ErrPending) {
+		t.Fatalf("expected the step error, got %v", err)
+	}
+
+	want := []string{"a", "b", "c", "undo.b", "undo.a"}
+	if len(f.calls) != len(want) {
+		t.Fatalf("calls %v, want %v", f.calls, want)
+	}
+	for i := range want {
+		if f.calls[i] != want[i] {
+			t.Fatalf("calls %v, want %v", f.calls, want)
+		}
+	}
+
+	stored, _ := f.orchestrator.Saga(context.Background(), s.ID)
+	if stored.Status != StatusFailed || stored.Records[0].Status != StepCompensated || stored.Records[2].Status != StepFailed {
+		t.Fatalf("failed saga not persisted: %+v", stored)
+	}
+}
+
+func TestResumeIgnoresFinishedSaga(t *testing.T) {
+	f := newFixture(t)
+
+	s := f.saga()
+	if err := f.orchestrator.Run(context.Background(), s); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	payload, _ := json.Marshal(resumeJob{SagaID: s.ID})
+	if err := f.orchestrator.resume(context.Background(), payload); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if len(f.calls) != 3 {
+		t.Fatalf("finished saga was run again: %v", f.calls)
+	}
+}
@@ -101,6 +101,33 @@ func (jm *JWTManager) GenerateAccessToken(user *models.User, clientId string, sc
 	return tokenString, nil
 }
 
+// ServiceTokenTTL is short, service clients fetch a new token when it expires.
+const ServiceTokenTTL = time.Hour
+
+// GenerateServiceToken issues an access token for a backend service. Its role
+// is "service" and it carries no user identity; with the delegate scope the
+// service may name the reader it acts for in the X-Acting-User header.
+func (jm *JWTManager) GenerateServiceToken(clientId string, scopes string) (string, error) {
+	now := time.Now()
+	expiresAt := now.Add(ServiceTokenTTL)
+
+	claims := jwt.MapClaims{
+		"sub":                clientId,
+		"preferred_username": clientId,
+		"role":               "service",
+		"scope":              scopes,
+		"iat":                now.Unix(),
+		"exp":                expiresAt.Unix(),
+		"iss":                jm.issuer,
+		"aud":                clientId,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+
+	return token.SignedString(jm.privateKey)
+}
+
 func (jm *JWTManager) GenerateIdToken(user *models.User, clientId string, scopes string, nonce string) (string, error) {
 	now := time.Now()
 	expiresAt := now.Add(24 * 30 * time.Hour)
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"crypto/subtle"
 	_ "embed"
 	"fmt"
 	"strings"
@@ -21,18 +22,22 @@ var loginTemplate string
 var signupTemplate string
 
 type Handler struct {
-	db         *storage.PgStorage
-	jwtManager *auth.JWTManager
-	issuer     string
-	baseURL    string
+	db             *storage.PgStorage
+	jwtManager     *auth.JWTManager
+	issuer         string
+	baseURL        string
+	serviceClients map[string]string
 }
 
-func NewHandler(db *storage.PgStorage, jwtManager *auth.JWTManager, baseURL string) *Handler {
+// NewHandler takes the secrets of the backend services allowed to use the
+// client_credentials grant, keyed by client id.
+func NewHandler(db *storage.PgStorage, jwtManager *auth.JWTManager, baseURL string, serviceClients map[string]string) *Handler {
 	return &Handler{
-		db:         db,
-		jwtManager: jwtManager,
-		issuer:     baseURL,
-		baseURL:    baseURL,
+		db:             db,
+		jwtManager:     jwtManager,
+		issuer:         baseURL,
+		baseURL:        baseURL,
+		serviceClients: serviceClients,
 	}
 }
 
@@ -201,6 +206,12 @@ func (h *Handler) Token(c *gin.Context) {
 		return
 	}
 
+	//services get their tokens on the internal port only, see ServiceToken
+	if req.GrantType == "client_credentials" {
+		c.JSON(400, models.ErrorResponse{Error: "unsupported_grant_type"})
+		return
+	}
+
 	var user *models.User
 	var err error
 
@@ -312,6 +323,41 @@ func (h *Handler) Token(c *gin.Context) {
 	c.JSON(200, response)
 }
 
+// ServiceToken implements the client_credentials grant for backend services.
+// It is served apart from Token, on a port not published outside the service
+// network.
+func (h *Handler) ServiceToken(c *gin.Context) {
+	var req models.TokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(400, models.ErrorResponse{Error: "invalid_request"})
+		return
+	}
+	if req.GrantType != "client_credentials" {
+		c.JSON(400, models.ErrorResponse{Error: "unsupported_grant_type"})
+		return
+	}
+
+	secret, ok := h.serviceClients[req.ClientId]
+	if !ok || secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(req.ClientSecret)) != 1 {
+		c.JSON(401, models.ErrorResponse{Error: "invalid_client"})
+		return
+	}
+
+	scope := "delegate"
+	accessToken, err := h.jwtManager.GenerateServiceToken(req.ClientId, scope)
+	if err != nil {
+		c.JSON(500, models.ErrorResponse{Error: "server_error"})
+		return
+	}
+
+	c.JSON(200, models.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(auth.ServiceTokenTTL.Seconds()),
+		Scope:       scope,
+	})
+}
+
 func (h *Handler) UserInfo(c *gin.Context) {
 	tokenString := c.GetHeader("Authorization")
 	if tokenString == "" {
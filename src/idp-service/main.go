@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 	"time"
 
 	"lab2/src/idp-service/auth"
@@ -43,7 +44,15 @@ func main() {
 		panic(err)
 	}
 
-	h := handler.NewHandler(db, jwtManager, "http://idp-service:8090")
+	//the gateway authenticates deferred calls on behalf of readers with its own token
+	serviceClients := map[string]string{
+		"gateway": os.Getenv("GATEWAY_CLIENT_SECRET"),
+	}
+	if serviceClients["gateway"] == "" {
+		panic("GATEWAY_CLIENT_SECRET is not set")
+	}
+
+	h := handler.NewHandler(db, jwtManager, "http://idp-service:8090", serviceClients)
 
 	router := gin.Default()
 
@@ -69,6 +78,15 @@ func main() {
 
 	router.GET("/manage/health", h.GetHealth)
 
+	//service tokens are issued on a port kept inside the service network
+	internal := gin.Default()
+	internal.POST("/oauth2/token", h.ServiceToken)
+	go func() {
+		if err := internal.Run(":8091"); err != nil {
+			panic(err)
+		}
+	}()
+
 	fmt.Println("Starting Identity Provider Service on port 8090")
 	router.Run(":8090")
 }
@@ -38,6 +38,7 @@ type TokenRequest struct {
 	Code         string `json:"code" form:"code"`
 	RedirectUri  string `json:"redirect_uri" form:"redirect_uri"`
 	ClientId     string `json:"client_id" form:"client_id" binding:"required"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
 	RefreshToken string `json:"refresh_token" form:"refresh_token"`
 	Username     string `json:"username" form:"username"`
 	Password     string `json:"password" form:"password"`
@@ -49,7 +50,7 @@ type TokenResponse struct {
 	TokenType    string `json:"token_type"`
 	ExpiresIn    int    `json:"expires_in"`
 	RefreshToken string `json:"refresh_token,omitempty"`
-	IdToken      string `json:"id_token"`
+	IdToken      string `json:"id_token,omitempty"`
 	Scope        string `json:"scope"`
 }
 
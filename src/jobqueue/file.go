@@ -0,0 +1,192 @@
+package jobqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileStore keeps jobs in a single JSON file. It is meant for local runs
+// without a database.
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	fs := &FileStore{
+		path: path,
+		jobs: make(map[string]*Job),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read job file: %w", err)
+	}
+
+	var jobs []*Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("unable to decode job file: %w", err)
+	}
+
+	for _, job := range jobs {
+		if job.Status == "" {
+			job.Status = StatusPending
+		}
+		fs.jobs[job.ID] = job
+	}
+
+	return fs, nil
+}
+
+func (fs *FileStore) Save(_ context.Context, job *Job) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	saved := *job
+	fs.jobs[job.ID] = &saved
+
+	return fs.flush()
+}
+
+// Claim is atomic only within the process; a FileStore is never shared.
+func (fs *FileStore) Claim(_ context.Context, now time.Time, lease time.Duration, limit int) ([]*Job, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	claimed := make([]*Job, 0)
+	for _, job := range fs.sorted() {
+		due := job.Status == StatusPending && !job.NextRunAt.After(now)
+		expired := job.Status == StatusRunning && job.LeaseUntil.Before(now)
+		if !due && !expired {
+			continue
+		}
+
+		job.Status = StatusRunning
+		job.LeaseUntil = now.Add(lease)
+		job.UpdatedAt = now
+		fs.jobs[job.ID] = job
+
+		copied := *job
+		claimed = append(claimed, &copied)
+		if limit > 0 && len(claimed) == limit {
+			break
+		}
+	}
+
+	if len(claimed) == 0 {
+		return claimed, nil
+	}
+
+	return claimed, fs.flush()
+}
+
+func (fs *FileStore) Delete(_ context.Context, id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	delete(fs.jobs, id)
+
+	return fs.flush()
+}
+
+func (fs *FileStore) Get(_ context.Context, id string) (*Job, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	job, ok := fs.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	copied := *job
+	return &copied, nil
+}
+
+func (fs *FileStore) List(_ context.Context, filter Filter) ([]*Job, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	jobs := make([]*Job, 0)
+	for _, job := range fs.sorted() {
+		if filter.Status != "" && job.Status != filter.Status {
+			continue
+		}
+		if filter.Type != "" && job.Type != filter.Type {
+			continue
+		}
+
+		jobs = append(jobs, job)
+		if filter.Limit > 0 && len(jobs) == filter.Limit {
+			break
+		}
+	}
+
+	return jobs, nil
+}
+
+func (fs *FileStore) DeleteSucceeded(_ context.Context, before time.Time) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for id, job := range fs.jobs {
+		if job.Status == StatusSucceeded && job.UpdatedAt.Before(before) {
+			delete(fs.jobs, id)
+		}
+	}
+
+	return fs.flush()
+}
+
+func (fs *FileStore) sorted() []*Job {
+	jobs := make([]*Job, 0, len(fs.jobs))
+	for _, job := range fs.jobs {
+		copied := *job
+		jobs = append(jobs, &copied)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].NextRunAt.Before(jobs[j].NextRunAt)
+	})
+
+	return jobs
+}
+
+// flush rewrites the file through a temporary file, so a crash never leaves
+// a half written queue behind.
+func (fs *FileStore) flush() error {
+	data, err := json.MarshalIndent(fs.sorted(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode jobs: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(fs.path), filepath.Base(fs.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("unable to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write jobs: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to sync jobs: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to close temp file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), fs.path)
+}
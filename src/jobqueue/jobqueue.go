@@ -1,57 +1,477 @@
 package jobqueue
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
+
+	"github.com/google/uuid"
 )
 
-type Job interface {
-	Execute() error
-}
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobNotDead  = errors.New("job is not in the dead letter list")
+)
 
-type ExecJob struct {
-	f func() (any, error)
+// Job is a serialized descriptor of a deferred call. The Type selects the
+// registered HandlerFunc and Payload is passed to it as is, so jobs survive
+// a restart of the process that created them.
+type Job struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Payload    json.RawMessage `json:"payload"`
+	Status     string          `json:"status"`
+	Policy     RetryPolicy     `json:"policy"`
+	Attempts   int             `json:"attempts"`
+	NextRunAt  time.Time       `json:"nextRunAt"`
+	Deadline   time.Time       `json:"deadline,omitempty"`
+	LeaseUntil time.Time       `json:"leaseUntil,omitempty"`
+	LastError  string          `json:"lastError,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	UpdatedAt  time.Time       `json:"updatedAt"`
 }
 
-func NewExecJob(f func() (any, error)) *ExecJob {
-	return &ExecJob{
-		f: f,
-	}
+// Filter narrows List results; empty fields match every job.
+type Filter struct {
+	Status string
+	Type   string
+	Limit  int
 }
 
-func (ej ExecJob) Execute() error {
-	fmt.Println("Execute job")
-	_, err := ej.f()
-	return err
+// HandlerFunc executes a job. ctx is cancelled when the attempt runs past the
+// job timeout or the scheduler is stopped without enough time to drain.
+type HandlerFunc func(ctx context.Context, payload json.RawMessage) error
+
+// DeadFunc is called after a job is moved to the dead letter list, with the
+// error of its last attempt.
+type DeadFunc func(ctx context.Context, payload json.RawMessage, err error)
+
+type Store interface {
+	Save(ctx context.Context, job *Job) error
+	// Claim atomically marks up to limit jobs as running until now+lease and
+	// returns them: pending jobs that are due, and running jobs whose lease
+	// ran out because the process that claimed them died. A job is never
+	// returned to two callers while its lease holds.
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Job, error)
+	Delete(ctx context.Context, id string) error
+	Get(ctx context.Context, id string) (*Job, error)
+	List(ctx context.Context, filter Filter) ([]*Job, error)
+	DeleteSucceeded(ctx context.Context, before time.Time) error
 }
 
 type JobScheduler struct {
-	JobQueue chan Job
-	Interval time.Duration
+	Interval  time.Duration
+	Workers   int
+	Retention time.Duration
+	// Lease is how long a claimed job is reserved for this scheduler. It has
+	// to outlast the Timeout of every policy, or a slow job may be claimed
+	// again by another instance.
+	Lease time.Duration
+
+	store    Store
+	handlers map[string]HandlerFunc
+	policies map[string]RetryPolicy
+	onDead   map[string]DeadFunc
+	mu       sync.RWMutex
+	wake     chan struct{}
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	queue      chan *Job
+	quit       chan struct{}
+	stopOnce   sync.Once
+	dispatcher sync.WaitGroup
+	workers    sync.WaitGroup
+	lastPurge  time.Time
 }
 
-func NewJobScheduler(interval time.Duration) *JobScheduler {
+func NewJobScheduler(store Store, interval time.Duration) *JobScheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return &JobScheduler{
-		JobQueue: make(chan Job),
-		Interval: interval,
+		Interval:  interval,
+		Workers:   1,
+		Retention: 7 * 24 * time.Hour,
+		Lease:     5 * time.Minute,
+		store:     store,
+		handlers:  make(map[string]HandlerFunc),
+		policies:  make(map[string]RetryPolicy),
+		onDead:    make(map[string]DeadFunc),
+		wake:      make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+		queue:     make(chan *Job),
+		quit:      make(chan struct{}),
 	}
 }
 
+// Register sets the handler for jobType. Jobs of this type are enqueued with
+// policy unless another one is given to EnqueueWithPolicy.
+func (s *JobScheduler) Register(jobType string, handler HandlerFunc, policy RetryPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers[jobType] = handler
+	s.policies[jobType] = policy
+}
+
+// OnDead sets the function called when a job of jobType runs out of attempts,
+// passes its deadline or fails permanently.
+func (s *JobScheduler) OnDead(jobType string, fn DeadFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onDead[jobType] = fn
+}
+
+// Execute runs the handler registered for jobType right away, without
+// persisting anything.
+func (s *JobScheduler) Execute(ctx context.Context, jobType string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("unable to marshal payload: %w", err)
+	}
+
+	s.mu.RLock()
+	policy := s.policies[jobType]
+	s.mu.RUnlock()
+
+	if policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.Timeout)
+		defer cancel()
+	}
+
+	return s.run(ctx, jobType, data)
+}
+
+// Enqueue persists a new job that is due immediately.
+func (s *JobScheduler) Enqueue(jobType string, payload any) (*Job, error) {
+	s.mu.RLock()
+	policy, ok := s.policies[jobType]
+	s.mu.RUnlock()
+
+	if !ok {
+		policy = DefaultRetryPolicy
+	}
+
+	return s.EnqueueWithPolicy(jobType, payload, policy)
+}
+
+func (s *JobScheduler) EnqueueWithPolicy(jobType string, payload any, policy RetryPolicy) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal payload: %w", err)
+	}
+
+	now := time.Now().UTC()
+	job := &Job{
+		ID:        uuid.New().String(),
+		Type:      jobType,
+		Payload:   data,
+		Status:    StatusPending,
+		Policy:    policy,
+		NextRunAt: now,
+		Deadline:  policy.DeadlineFrom(now),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := s.store.Save(context.Background(), job); err != nil {
+		return nil, fmt.Errorf("unable to save job: %w", err)
+	}
+
+	s.notify()
+
+	return job, nil
+}
+
+func (s *JobScheduler) Jobs(ctx context.Context, filter Filter) ([]*Job, error) {
+	return s.store.List(ctx, filter)
+}
+
+func (s *JobScheduler) Job(ctx context.Context, id string) (*Job, error) {
+	return s.store.Get(ctx, id)
+}
+
+func (s *JobScheduler) DeadJobs(ctx context.Context) ([]*Job, error) {
+	return s.store.List(ctx, Filter{Status: StatusDead})
+}
+
+// Replay moves a dead job back to the queue with a fresh attempt budget.
+func (s *JobScheduler) Replay(ctx context.Context, id string) (*Job, error) {
+	job, err := s.deadJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	job.Status = StatusPending
+	job.Attempts = 0
+	job.NextRunAt = now
+	job.Deadline = job.Policy.DeadlineFrom(now)
+	job.UpdatedAt = now
+
+	if err := s.store.Save(ctx, job); err != nil {
+		return nil, err
+	}
+
+	s.notify()
+
+	return job, nil
+}
+
+func (s *JobScheduler) Discard(ctx context.Context, id string) error {
+	if _, err := s.deadJob(ctx, id); err != nil {
+		return err
+	}
+
+	return s.store.Delete(ctx, id)
+}
+
+func (s *JobScheduler) deadJob(ctx context.Context, id string) (*Job, error) {
+	job, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.Status != StatusDead {
+		return nil, ErrJobNotDead
+	}
+
+	return job, nil
+}
+
+// Start launches the dispatcher and Workers worker goroutines. Pending jobs
+// left in the store by a previous run are picked up on the first iteration,
+// jobs that were running when the process died once their lease runs out.
 func (s *JobScheduler) Start() {
+	for range s.workerCount() {
+		s.workers.Add(1)
+		go s.worker()
+	}
+
+	s.dispatcher.Add(1)
+	go s.dispatch()
+}
+
+// Stop stops taking new jobs and waits for the in-flight ones to finish. If
+// ctx expires first, the running jobs are cancelled and ctx.Err() is
+// returned; they stay pending in the store and run again after a restart.
+func (s *JobScheduler) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.quit)
+	})
+
+	done := make(chan struct{})
 	go func() {
+		s.dispatcher.Wait()
+		s.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		return ctx.Err()
+	}
+}
+
+func (s *JobScheduler) workerCount() int {
+	if s.Workers < 1 {
+		return 1
+	}
+
+	return s.Workers
+}
+
+func (s *JobScheduler) setStatus(job *Job, status string) {
+	job.Status = status
+	job.UpdatedAt = time.Now().UTC()
+	if status != StatusRunning {
+		job.LeaseUntil = time.Time{}
+	}
+
+	if err := s.store.Save(context.Background(), job); err != nil {
+		fmt.Printf("failed to save job %s: %s\n", job.ID, err.Error())
+	}
+}
+
+func (s *JobScheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
 
-		for {
-			select {
-			case job := <-s.JobQueue:
-				err := job.Execute()
-				if err != nil {
-					go func() {
-						time.Sleep(s.Interval)
-						s.JobQueue <- job
-					}()
-				}
+func (s *JobScheduler) dispatch() {
+	defer s.dispatcher.Done()
+	defer close(s.queue)
 
+	for {
+		wait, ok := s.dispatchDue()
+		if !ok {
+			return
+		}
+
+		select {
+		case <-s.quit:
+			return
+		case <-s.wake:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// dispatchDue claims a batch of due jobs in the store, hands them to the
+// workers and returns how long to sleep before the next one, never longer
+// than Interval. It returns false once the scheduler is stopping.
+func (s *JobScheduler) dispatchDue() (time.Duration, bool) {
+	wait := s.Interval
+
+	s.purgeSucceeded()
+
+	now := time.Now().UTC()
+	limit := s.workerCount()
+
+	jobs, err := s.store.Claim(s.ctx, now, s.Lease, limit)
+	if err != nil {
+		fmt.Printf("failed to claim jobs: %s\n", err.Error())
+		return wait, true
+	}
+
+	for i, job := range jobs {
+		select {
+		case s.queue <- job:
+		case <-s.quit:
+			//hand the rest back instead of waiting for their lease
+			for _, unclaimed := range jobs[i:] {
+				s.setStatus(unclaimed, StatusPending)
 			}
+			return 0, false
 		}
-	}()
+	}
+
+	//a full batch: more jobs may be due already
+	if len(jobs) == limit {
+		return 0, true
+	}
+
+	next, err := s.store.List(s.ctx, Filter{Status: StatusPending, Limit: 1})
+	if err != nil {
+		fmt.Printf("failed to load pending jobs: %s\n", err.Error())
+		return wait, true
+	}
+
+	if len(next) > 0 {
+		if until := next[0].NextRunAt.Sub(now); until < wait {
+			wait = until
+		}
+	}
+
+	return wait, true
+}
+
+// purgeSucceeded removes succeeded jobs older than Retention, at most once
+// per Interval.
+func (s *JobScheduler) purgeSucceeded() {
+	now := time.Now().UTC()
+	if s.Retention <= 0 || now.Sub(s.lastPurge) < s.Interval {
+		return
+	}
+	s.lastPurge = now
+
+	if err := s.store.DeleteSucceeded(s.ctx, now.Add(-s.Retention)); err != nil {
+		fmt.Printf("failed to purge succeeded jobs: %s\n", err.Error())
+	}
+}
+
+func (s *JobScheduler) worker() {
+	defer s.workers.Done()
+
+	for job := range s.queue {
+		s.process(job)
+		s.notify()
+	}
+}
+
+func (s *JobScheduler) process(job *Job) {
+	ctx := s.ctx
+	if job.Policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, job.Policy.Timeout)
+		defer cancel()
+	}
+
+	fmt.Printf("Execute job %s (%s)\n", job.ID, job.Type)
+
+	job.Attempts++
+	s.setStatus(job, StatusRunning)
+
+	err := s.run(ctx, job.Type, job.Payload)
+
+	//interrupted by Stop: keep the job pending for the next run
+	if s.ctx.Err() != nil {
+		job.Attempts--
+		s.setStatus(job, StatusPending)
+		return
+	}
+
+	if err == nil {
+		job.LastError = ""
+		s.setStatus(job, StatusSucceeded)
+		return
+	}
+
+	s.fail(job, err)
+}
+
+func (s *JobScheduler) fail(job *Job, err error) {
+	now := time.Now().UTC()
+
+	job.LastError = err.Error()
+
+	exhausted := job.Policy.MaxAttempts > 0 && job.Attempts >= job.Policy.MaxAttempts
+	expired := !job.Deadline.IsZero() && now.After(job.Deadline)
+
+	if isPermanent(err) || exhausted || expired {
+		fmt.Printf("job %s (%s) moved to dead letter list after %d attempts: %s\n", job.ID, job.Type, job.Attempts, job.LastError)
+		s.setStatus(job, StatusDead)
+
+		s.mu.RLock()
+		onDead, ok := s.onDead[job.Type]
+		s.mu.RUnlock()
+		if ok {
+			onDead(s.ctx, job.Payload, err)
+		}
+		return
+	}
+
+	job.NextRunAt = now.Add(job.Policy.Backoff(job.Attempts))
+	s.setStatus(job, StatusPending)
+}
+
+func (s *JobScheduler) run(ctx context.Context, jobType string, payload json.RawMessage) error {
+	s.mu.RLock()
+	handler, ok := s.handlers[jobType]
+	s.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("unknown job type: %s", jobType)
+	}
+
+	return handler(ctx, payload)
 }
@@ -0,0 +1,274 @@
+package jobqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// runPending processes every pending job once, ignoring backoff.
+func runPending(t *testing.T, s *JobScheduler) {
+	t.Helper()
+
+	jobs, err := s.store.List(context.Background(), Filter{Status: StatusPending})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	for _, job := range jobs {
+		s.process(job)
+	}
+}
+
+func TestFileStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+
+	scheduler := NewJobScheduler(store, time.Minute)
+	job, err := scheduler.Enqueue("rating.update", map[string]int{"stars": 1})
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	reloaded, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore reload: %v", err)
+	}
+
+	jobs, err := reloaded.List(context.Background(), Filter{Status: StatusPending})
+	if err != nil {
+		t.Fatalf("Pending: %v", err)
+	}
+
+	if len(jobs) != 1 || jobs[0].ID != job.ID || jobs[0].Type != "rating.update" {
+		t.Fatalf("unexpected pending jobs after reload: %+v", jobs)
+	}
+}
+
+func TestClaimHoldsLease(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+
+	scheduler := NewJobScheduler(store, time.Minute)
+	job, err := scheduler.Enqueue("rating.update", nil)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	now := time.Now().UTC()
+	claimed, err := store.Claim(context.Background(), now, time.Minute, 10)
+	if err != nil || len(claimed) != 1 || claimed[0].ID != job.ID || claimed[0].Status != StatusRunning {
+		t.Fatalf("expected job to be claimed, got %+v, %v", claimed, err)
+	}
+
+	//another scheduler sharing the store must not get it while the lease holds
+	if again, _ := store.Claim(context.Background(), now.Add(30*time.Second), time.Minute, 10); len(again) != 0 {
+		t.Fatalf("expected leased job to stay claimed, got %+v", again)
+	}
+
+	//the claimer died: the job is taken over after the lease
+	reclaimed, _ := store.Claim(context.Background(), now.Add(2*time.Minute), time.Minute, 10)
+	if len(reclaimed) != 1 || reclaimed[0].ID != job.ID {
+		t.Fatalf("expected expired lease to be reclaimed, got %+v", reclaimed)
+	}
+}
+
+func TestRunDueRecordsFailure(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+
+	scheduler := NewJobScheduler(store, time.Minute)
+	scheduler.Register("failing", func(ctx context.Context, payload json.RawMessage) error {
+		return errors.New("service unavailable")
+	}, DefaultRetryPolicy)
+
+	if _, err := scheduler.Enqueue("failing", nil); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	runPending(t, scheduler)
+
+	jobs, _ := store.List(context.Background(), Filter{Status: StatusPending})
+	if len(jobs) != 1 {
+		t.Fatalf("expected job to stay pending, got %d jobs", len(jobs))
+	}
+
+	if jobs[0].Attempts != 1 || jobs[0].LastError != "service unavailable" || !jobs[0].NextRunAt.After(time.Now()) {
+		t.Fatalf("failure not recorded: %+v", jobs[0])
+	}
+}
+
+func TestExhaustedJobIsDeadLettered(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+
+	var lastErr error
+
+	scheduler := NewJobScheduler(store, time.Minute)
+	scheduler.Register("failing", func(ctx context.Context, payload json.RawMessage) error {
+		return errors.New("service unavailable")
+	}, RetryPolicy{MaxAttempts: 2})
+	scheduler.OnDead("failing", func(ctx context.Context, payload json.RawMessage, err error) {
+		lastErr = err
+	})
+
+	job, err := scheduler.Enqueue("failing", nil)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	runPending(t, scheduler)
+	if lastErr != nil {
+		t.Fatalf("dead letter callback called before the last attempt: %v", lastErr)
+	}
+	runPending(t, scheduler)
+
+	dead, _ := scheduler.DeadJobs(context.Background())
+	if len(dead) != 1 || dead[0].ID != job.ID || dead[0].Attempts != 2 {
+		t.Fatalf("expected job in dead letter list, got %+v", dead)
+	}
+	if lastErr == nil || lastErr.Error() != "service unavailable" {
+		t.Fatalf("expected dead letter callback with the last error, got %v", lastErr)
+	}
+
+	replayed, err := scheduler.Replay(context.Background(), job.ID)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+
+	if replayed.Status != StatusPending || replayed.Attempts != 0 {
+		t.Fatalf("unexpected replayed job: %+v", replayed)
+	}
+}
+
+func TestPermanentErrorSkipsRetries(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+
+	scheduler := NewJobScheduler(store, time.Minute)
+	scheduler.Register("rejected", func(ctx context.Context, payload json.RawMessage) error {
+		return Permanent(errors.New("bad request"))
+	}, DefaultRetryPolicy)
+
+	job, _ := scheduler.Enqueue("rejected", nil)
+	runPending(t, scheduler)
+
+	if err := scheduler.Discard(context.Background(), job.ID); err != nil {
+		t.Fatalf("Discard: %v", err)
+	}
+
+	if _, err := store.Get(context.Background(), job.ID); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("expected discarded job to be gone, got %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second, Multiplier: 2}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second}
+	for i, want := range expected {
+		if got := policy.Backoff(i + 1); got != want {
+			t.Errorf("attempt %d: expected %s, got %s", i+1, want, got)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for range 100 {
+		if got := policy.Backoff(1); got < 500*time.Millisecond || got > 1500*time.Millisecond {
+			t.Fatalf("jittered backoff out of range: %s", got)
+		}
+	}
+}
+
+func TestJobTimeout(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+
+	scheduler := NewJobScheduler(store, time.Minute)
+	scheduler.Register("slow", func(ctx context.Context, payload json.RawMessage) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, RetryPolicy{Timeout: 10 * time.Millisecond})
+
+	job, _ := scheduler.Enqueue("slow", nil)
+	runPending(t, scheduler)
+
+	saved, err := store.Get(context.Background(), job.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	if saved.Attempts != 1 || saved.LastError != context.DeadlineExceeded.Error() {
+		t.Fatalf("timeout not recorded: %+v", saved)
+	}
+}
+
+func TestStopDrainsInFlightJobs(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+
+	scheduler := NewJobScheduler(store, time.Minute)
+	scheduler.Workers = 2
+	scheduler.Register("blocking", func(ctx context.Context, payload json.RawMessage) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}, DefaultRetryPolicy)
+
+	scheduler.Enqueue("blocking", nil)
+	scheduler.Enqueue("blocking", nil)
+	scheduler.Start()
+
+	//both jobs run at the same time on separate workers
+	for range 2 {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("jobs were not started concurrently")
+		}
+	}
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- scheduler.Stop(context.Background())
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned before in-flight jobs finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+
+	if err := <-stopped; err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	jobs, _ := store.List(context.Background(), Filter{Status: StatusSucceeded})
+	if len(jobs) != 2 {
+		t.Fatalf("expected both jobs to succeed, got %d", len(jobs))
+	}
+}
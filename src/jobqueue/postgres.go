@@ -0,0 +1,145 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const jobColumns = `id, type, payload, status, policy, attempts, next_run_at, deadline, lease_until, last_error, created_at, updated_at`
+
+type PgStore struct {
+	db *pgxpool.Pool
+}
+
+func NewPgStore(ctx context.Context, connString string) (*PgStore, error) {
+	db, err := pgxpool.New(ctx, connString)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create connection pool: %w", err)
+	}
+
+	return &PgStore{db: db}, nil
+}
+
+func (ps *PgStore) Close() {
+	ps.db.Close()
+}
+
+func (ps *PgStore) Save(ctx context.Context, job *Job) error {
+	query := `INSERT INTO jobs (` + jobColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	ON CONFLICT (id) DO UPDATE SET status = EXCLUDED.status, attempts = EXCLUDED.attempts,
+	next_run_at = EXCLUDED.next_run_at, deadline = EXCLUDED.deadline, lease_until = EXCLUDED.lease_until,
+	last_error = EXCLUDED.last_error, updated_at = EXCLUDED.updated_at`
+
+	_, err := ps.db.Exec(ctx, query, job.ID, job.Type, job.Payload, job.Status, job.Policy, job.Attempts,
+		job.NextRunAt, nullTime(job.Deadline), nullTime(job.LeaseUntil), job.LastError, job.CreatedAt, job.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("unable to save job: %w", err)
+	}
+
+	return nil
+}
+
+// Claim locks the due jobs with SKIP LOCKED, so concurrent schedulers
+// sharing the table split them instead of waiting for each other.
+func (ps *PgStore) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Job, error) {
+	query := `UPDATE jobs SET status = $1, lease_until = $2, updated_at = $3
+	WHERE id IN (
+		SELECT id FROM jobs
+		WHERE (status = $4 AND next_run_at <= $3) OR (status = $1 AND (lease_until IS NULL OR lease_until < $3))
+		ORDER BY next_run_at
+		LIMIT $5
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + jobColumns
+
+	rows, err := ps.db.Query(ctx, query, StatusRunning, now.Add(lease), now, StatusPending, limit)
+	if err != nil {
+		return nil, fmt.Errorf("unable to claim jobs: %w", err)
+	}
+	defer rows.Close()
+
+	return pgx.CollectRows(rows, scanJob)
+}
+
+func (ps *PgStore) Delete(ctx context.Context, id string) error {
+	_, err := ps.db.Exec(ctx, `DELETE FROM jobs WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("unable to delete job: %w", err)
+	}
+
+	return nil
+}
+
+func (ps *PgStore) Get(ctx context.Context, id string) (*Job, error) {
+	rows, err := ps.db.Query(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query: %w", err)
+	}
+	defer rows.Close()
+
+	job, err := pgx.CollectOneRow(rows, scanJob)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+
+	return job, err
+}
+
+func (ps *PgStore) List(ctx context.Context, filter Filter) ([]*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs
+	WHERE ($1 = '' OR status = $1) AND ($2 = '' OR type = $2)
+	ORDER BY next_run_at`
+	args := []any{filter.Status, filter.Type}
+
+	if filter.Limit > 0 {
+		query += ` LIMIT $3`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := ps.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query: %w", err)
+	}
+	defer rows.Close()
+
+	return pgx.CollectRows(rows, scanJob)
+}
+
+func (ps *PgStore) DeleteSucceeded(ctx context.Context, before time.Time) error {
+	_, err := ps.db.Exec(ctx, `DELETE FROM jobs WHERE status = $1 AND updated_at < $2`, StatusSucceeded, before)
+	if err != nil {
+		return fmt.Errorf("unable to delete jobs: %w", err)
+	}
+
+	return nil
+}
+
+func scanJob(row pgx.CollectableRow) (*Job, error) {
+	var job Job
+	var deadline, leaseUntil *time.Time
+
+	err := row.Scan(&job.ID, &job.Type, &job.Payload, &job.Status, &job.Policy, &job.Attempts,
+		&job.NextRunAt, &deadline, &leaseUntil, &job.LastError, &job.CreatedAt, &job.UpdatedAt)
+	if deadline != nil {
+		job.Deadline = *deadline
+	}
+	if leaseUntil != nil {
+		job.LeaseUntil = *leaseUntil
+	}
+
+	return &job, err
+}
+
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
@@ -0,0 +1,93 @@
+package jobqueue
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy controls how a failed job is rescheduled. The delay before the
+// n-th retry is InitialBackoff * Multiplier^(n-1), capped at MaxBackoff and
+// spread by +-Jitter (a fraction of the delay). A job is moved to the dead
+// letter list after MaxAttempts failures or once Deadline has passed since it
+// was enqueued or replayed; zero values disable either limit. Timeout bounds
+// a single attempt.
+type RetryPolicy struct {
+	InitialBackoff time.Duration `json:"initialBackoff"`
+	MaxBackoff     time.Duration `json:"maxBackoff"`
+	Multiplier     float64       `json:"multiplier"`
+	Jitter         float64       `json:"jitter"`
+	MaxAttempts    int           `json:"maxAttempts"`
+	Deadline       time.Duration `json:"deadline"`
+	Timeout        time.Duration `json:"timeout"`
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	InitialBackoff: 2 * time.Second,
+	MaxBackoff:     5 * time.Minute,
+	Multiplier:     2,
+	Jitter:         0.2,
+	MaxAttempts:    10,
+	Deadline:       24 * time.Hour,
+	Timeout:        30 * time.Second,
+}
+
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		delay = delay * (1 - p.Jitter + 2*p.Jitter*rand.Float64())
+	}
+
+	return time.Duration(delay)
+}
+
+// DeadlineFrom returns the time after which a job started at start is given
+// up, or the zero time when the policy has no deadline.
+func (p RetryPolicy) DeadlineFrom(start time.Time) time.Time {
+	if p.Deadline <= 0 {
+		return time.Time{}
+	}
+
+	return start.Add(p.Deadline)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error that retrying cannot fix. A job failing with it
+// goes to the dead letter list right away.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
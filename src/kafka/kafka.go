@@ -40,3 +40,30 @@ func CloseProducer(producer sarama.SyncProducer) error {
 	}
 	return producer.Close()
 }
+
+// NewConsumerGroup joins groupID, starting from initial (sarama.OffsetOldest
+// or sarama.OffsetNewest) when the group has no committed offset.
+func NewConsumerGroup(brokers []string, groupID string, initial int64) (sarama.ConsumerGroup, error) {
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_0_0_0
+	config.Consumer.Return.Errors = true
+	config.Consumer.Offsets.Initial = initial
+
+	var consumerGroup sarama.ConsumerGroup
+	var err error
+
+	maxRetries := 5
+	retryInterval := 2 * time.Second
+
+	for i := 0; i < maxRetries; i++ {
+		consumerGroup, err = sarama.NewConsumerGroup(brokers, groupID, config)
+		if err == nil {
+			return consumerGroup, nil
+		}
+
+		log.Printf("Waiting for Kafka consumer... attempt %d/%d: %v", i+1, maxRetries, err)
+		time.Sleep(retryInterval)
+	}
+
+	return nil, fmt.Errorf("failed to create kafka consumer group: %w", err)
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"lab2/src/library-service/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const maxBatchSize = 100
+
+// parseUids reads the uids query parameter, given either comma separated or
+// repeated, and drops duplicates.
+func parseUids(c *gin.Context) ([]string, error) {
+	seen := make(map[string]bool)
+	uids := make([]string, 0)
+
+	for _, value := range c.QueryArray("uids") {
+		for _, uid := range strings.Split(value, ",") {
+			uid = strings.TrimSpace(uid)
+			if uid == "" || seen[uid] {
+				continue
+			}
+			if _, err := uuid.Parse(uid); err != nil {
+				return nil, fmt.Errorf("invalid uid %q", uid)
+			}
+			seen[uid] = true
+			uids = append(uids, uid)
+		}
+	}
+
+	if len(uids) > maxBatchSize {
+		return nil, fmt.Errorf("at most %d uids per request", maxBatchSize)
+	}
+
+	return uids, nil
+}
+
+func (h *Handler) getLibrariesByUids(c *gin.Context) {
+	uids, err := parseUids(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	libraries, err := h.storage.GetLibrariesByUids(context.Background(), uids)
+	if err != nil {
+		fmt.Printf("failed to get libraries %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	response := LibrariesToResponse(libraries)
+	if response == nil {
+		response = make([]LibraryResponse, 0)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *Handler) GetBooksByUids(c *gin.Context) {
+	uids, err := parseUids(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	books, err := h.storage.GetBooksByUids(context.Background(), uids)
+	if err != nil {
+		fmt.Printf("failed to get books %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, BookInfosToResponse(books))
+}
+
+func BookInfosToResponse(books []storage.BookInfo) []BookToUserResponse {
+	res := make([]BookToUserResponse, len(books))
+
+	for index, value := range books {
+		res[index] = BookToUserResponse{
+			Book_uid: value.Book_uid,
+			Name:     value.Name,
+			Author:   value.Author,
+			Genre:    value.Genre,
+		}
+	}
+
+	return res
+}
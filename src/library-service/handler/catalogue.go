@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"lab2/src/library-service/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LibraryRequest struct {
+	Name    string `json:"name"`
+	City    string `json:"city"`
+	Address string `json:"address"`
+}
+
+type BookRequest struct {
+	Name      string `json:"name"`
+	Author    string `json:"author"`
+	Genre     string `json:"genre"`
+	Condition string `json:"condition"`
+}
+
+// CopiesRequest adds Delta copies to a holding, or retires them when Delta is
+// negative.
+type CopiesRequest struct {
+	Delta *int `json:"delta"`
+}
+
+type CatalogueBookResponse struct {
+	Book_uid  string `json:"bookUid"`
+	Name      string `json:"name"`
+	Author    string `json:"author"`
+	Genre     string `json:"genre"`
+	Condition string `json:"condition"`
+}
+
+var bookConditions = map[string]bool{"EXCELLENT": true, "GOOD": true, "BAD": true}
+
+func (r *LibraryRequest) validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	r.City = strings.TrimSpace(r.City)
+	r.Address = strings.TrimSpace(r.Address)
+
+	if err := requireText("name", r.Name, 80); err != nil {
+		return err
+	}
+	if err := requireText("city", r.City, 255); err != nil {
+		return err
+	}
+	return requireText("address", r.Address, 255)
+}
+
+func (r *BookRequest) validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	r.Author = strings.TrimSpace(r.Author)
+	r.Genre = strings.TrimSpace(r.Genre)
+
+	if err := requireText("name", r.Name, 255); err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(r.Author) > 255 || utf8.RuneCountInString(r.Genre) > 255 {
+		return errors.New("author and genre must be at most 255 characters")
+	}
+
+	if r.Condition == "" {
+		r.Condition = "EXCELLENT"
+	}
+	if !bookConditions[r.Condition] {
+		return errors.New("condition must be one of EXCELLENT, GOOD, BAD")
+	}
+
+	return nil
+}
+
+func (r *CopiesRequest) validate() error {
+	if r.Delta == nil {
+		return errors.New("delta is required")
+	}
+	if *r.Delta == 0 {
+		return errors.New("delta must not be zero")
+	}
+
+	return nil
+}
+
+func requireText(field string, value string, max int) error {
+	if value == "" {
+		return fmt.Errorf("%s is required", field)
+	}
+	if utf8.RuneCountInString(value) > max {
+		return fmt.Errorf("%s must be at most %d characters", field, max)
+	}
+
+	return nil
+}
+
+func (h *Handler) CreateLibrary(c *gin.Context) {
+	var req LibraryRequest
+	if !decodeCatalogueRequest(c, &req, req.validate) {
+		return
+	}
+
+	library, err := h.storage.CreateLibrary(context.Background(), c.GetString("username"), storage.Library{
+		Name:    req.Name,
+		City:    req.City,
+		Address: req.Address,
+	})
+	if err != nil {
+		catalogueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, LibraryToResponse(library))
+}
+
+func (h *Handler) UpdateLibrary(c *gin.Context) {
+	var req LibraryRequest
+	if !decodeCatalogueRequest(c, &req, req.validate) {
+		return
+	}
+
+	library, err := h.storage.UpdateLibrary(context.Background(), c.GetString("username"), storage.Library{
+		Library_uid: c.Param("uid"),
+		Name:        req.Name,
+		City:        req.City,
+		Address:     req.Address,
+	})
+	if err != nil {
+		catalogueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, LibraryToResponse(library))
+}
+
+func (h *Handler) DeleteLibrary(c *gin.Context) {
+	if err := h.storage.DeleteLibrary(context.Background(), c.GetString("username"), c.Param("uid")); err != nil {
+		catalogueError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) CreateBook(c *gin.Context) {
+	var req BookRequest
+	if !decodeCatalogueRequest(c, &req, req.validate) {
+		return
+	}
+
+	book, err := h.storage.CreateBook(context.Background(), c.GetString("username"), storage.BookInfo{
+		Name:      req.Name,
+		Author:    req.Author,
+		Genre:     req.Genre,
+		Condition: req.Condition,
+	})
+	if err != nil {
+		catalogueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, BookInfoToResponse(book))
+}
+
+func (h *Handler) UpdateBook(c *gin.Context) {
+	var req BookRequest
+	if !decodeCatalogueRequest(c, &req, req.validate) {
+		return
+	}
+
+	book, err := h.storage.UpdateBook(context.Background(), c.GetString("username"), storage.BookInfo{
+		Book_uid:  c.Param("uid"),
+		Name:      req.Name,
+		Author:    req.Author,
+		Genre:     req.Genre,
+		Condition: req.Condition,
+	})
+	if err != nil {
+		catalogueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, BookInfoToResponse(book))
+}
+
+func (h *Handler) DeleteBook(c *gin.Context) {
+	if err := h.storage.DeleteBook(context.Background(), c.GetString("username"), c.Param("uid")); err != nil {
+		catalogueError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// SetHolding links a book to a library. Copies are added with ChangeCopies.
+func (h *Handler) SetHolding(c *gin.Context) {
+	book, err := h.storage.SetHolding(context.Background(), c.GetString("username"), c.Param("uid"), c.Param("bookUid"))
+	if err != nil {
+		catalogueError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, BookToResponse(book))
+}
+
+func (h *Handler) ChangeCopies(c *gin.Context) {
+	var req CopiesRequest
+	if !decodeCatalogueRequest(c, &req, req.validate) {
+		return
+	}
+
+	count, err := h.storage.ChangeCopies(context.Background(), c.GetString("username"), c.Param("uid"), c.Param("bookUid"), c.GetHeader("Idempotency-Key"), *req.Delta)
+	h.stockResponse(c, count, err)
+}
+
+// DeleteHolding removes a book from a library once no copy is out on loan.
+func (h *Handler) DeleteHolding(c *gin.Context) {
+	loans, err := h.reservations.ActiveLoans(c.Request.Context(), c.GetHeader("Authorization"), c.Param("uid"), c.Param("bookUid"))
+	if err != nil {
+		fmt.Printf("failed to count active loans %s\n", err.Error())
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+			Message: "Reservation Service unavailable",
+		})
+		return
+	}
+	if loans > 0 {
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Message: fmt.Sprintf("%d copies are on loan", loans),
+		})
+		return
+	}
+
+	if err := h.storage.DeleteHolding(context.Background(), c.GetString("username"), c.Param("uid"), c.Param("bookUid")); err != nil {
+		catalogueError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func BookInfoToResponse(book storage.BookInfo) CatalogueBookResponse {
+	return CatalogueBookResponse{
+		Book_uid:  book.Book_uid,
+		Name:      book.Name,
+		Author:    book.Author,
+		Genre:     book.Genre,
+		Condition: book.Condition,
+	}
+}
+
+func decodeCatalogueRequest(c *gin.Context, req any, validate func() error) bool {
+	if err := json.NewDecoder(c.Request.Body).Decode(req); err != nil {
+		fmt.Printf("failed to decode body %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return false
+	}
+
+	if err := validate(); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return false
+	}
+
+	return true
+}
+
+func catalogueError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, storage.ErrLibraryNotFound), errors.Is(err, storage.ErrUnknownBook), errors.Is(err, storage.ErrBookNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Message: err.Error(),
+		})
+	case errors.Is(err, storage.ErrInUse):
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Message: err.Error(),
+		})
+	default:
+		fmt.Printf("failed to update catalogue %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+}
@@ -3,13 +3,16 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"lab2/src/library-service/storage"
+	"lab2/src/pagination"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
 )
 
 type ErrorResponse struct {
@@ -36,6 +39,10 @@ type BookResponse struct {
 	Available_count int    `json:"availableCount"`
 }
 
+type StockResponse struct {
+	Available_count int `json:"availableCount"`
+}
+
 type BookToUserResponse struct {
 	Book_uid string `json:"bookUid"`
 	Name     string `json:"name"`
@@ -49,16 +56,29 @@ type RequestUpdateReservation struct {
 }
 
 type Handler struct {
-	storage storage.Storage
+	storage      storage.Storage
+	reservations Reservations
 }
 
-func NewHandler(storage storage.Storage) *Handler {
-	return &Handler{storage: storage}
+func NewHandler(storage storage.Storage, reservations Reservations) *Handler {
+	return &Handler{storage: storage, reservations: reservations}
 }
 
 func (h *Handler) GetLibrariesByCity(c *gin.Context) {
+	if _, ok := c.GetQuery("uids"); ok {
+		h.getLibrariesByUids(c)
+		return
+	}
 
-	libraries, err := h.storage.GetLibrariesByCity(context.Background(), c.Query("city"))
+	page, err := pagination.Parse(c.Query("page"), c.Query("size"), c.Query("sort"), storage.LibrarySortColumns, "name")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	libraries, total, err := h.storage.GetLibrariesByCity(context.Background(), c.Query("city"), page)
 
 	if err != nil {
 		fmt.Printf("failed to get libraries %s\n", err.Error())
@@ -68,7 +88,7 @@ func (h *Handler) GetLibrariesByCity(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, LibrariesToResponse(libraries))
+	c.JSON(http.StatusOK, pagination.NewResponse(page, total, LibrariesToResponse(libraries)))
 }
 
 func (h *Handler) GetBooksByLibraryUid(c *gin.Context) {
@@ -78,22 +98,15 @@ func (h *Handler) GetBooksByLibraryUid(c *gin.Context) {
 		showAll = false
 	}
 
-	books, err := h.storage.GetBooksByLibraryUid(context.Background(), c.Param("uid"), showAll)
-
+	page, err := pagination.Parse(c.Query("page"), c.Query("size"), c.Query("sort"), storage.BookSortColumns, "name")
 	if err != nil {
-		fmt.Printf("failed to get libraries %s\n", err.Error())
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, BooksToResponse(books))
-}
-
-func (h *Handler) UpdateBookCount(c *gin.Context) {
-
-	book, err := h.storage.GetBookByUid(context.Background(), c.Param("uid"))
+	books, total, err := h.storage.GetBooksByLibraryUid(context.Background(), c.Param("uid"), showAll, page)
 
 	if err != nil {
 		fmt.Printf("failed to get libraries %s\n", err.Error())
@@ -103,24 +116,43 @@ func (h *Handler) UpdateBookCount(c *gin.Context) {
 		return
 	}
 
-	count := 1
-	if c.Param("inc") == "1" {
-		count = -1
-	}
+	c.JSON(http.StatusOK, pagination.NewResponse(page, total, BooksToResponse(books)))
+}
+
+func (h *Handler) TakeBook(c *gin.Context) {
+	count, err := h.storage.TakeBook(context.Background(), c.Param("uid"), c.Param("bookUid"), c.GetHeader("Idempotency-Key"))
+	h.stockResponse(c, count, err)
+}
 
-	err = h.storage.UpdateBookCount(context.Background(), book.ID, book.Available_count-count)
+func (h *Handler) ReturnBook(c *gin.Context) {
+	count, err := h.storage.ReturnBook(context.Background(), c.Param("uid"), c.Param("bookUid"), c.GetHeader("Idempotency-Key"))
+	h.stockResponse(c, count, err)
+}
 
-	if err != nil {
+func (h *Handler) stockResponse(c *gin.Context, count int, err error) {
+	switch {
+	case errors.Is(err, storage.ErrOutOfStock):
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Message: err.Error(),
+		})
+	case errors.Is(err, storage.ErrBookNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Message: err.Error(),
+		})
+	case errors.Is(err, storage.ErrKeyReused):
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{
+			Message: err.Error(),
+		})
+	case err != nil:
 		fmt.Printf("failed to update book count %s\n", err.Error())
-		c.JSON(http.StatusBadRequest, ErrorResponse{
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Message: err.Error(),
 		})
-		return
+	default:
+		c.JSON(http.StatusOK, StockResponse{
+			Available_count: count,
+		})
 	}
-
-	c.JSON(http.StatusOK, MessageResponse{
-		Message: "count updated",
-	})
 }
 
 func (h *Handler) UpdateBookCondition(c *gin.Context) {
@@ -187,6 +219,28 @@ func (h *Handler) GetBookInfoByUid(c *gin.Context) {
 	})
 }
 
+func (h *Handler) GetLibraryBook(c *gin.Context) {
+
+	book, err := h.storage.GetLibraryBook(context.Background(), c.Param("uid"), c.Param("bookUid"))
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Message: storage.ErrBookNotFound.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("failed to get book %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, BookToResponse(book))
+}
+
 func (h *Handler) GetLibraryByUid(c *gin.Context) {
 
 	library, err := h.storage.GetLibraryByUid(context.Background(), c.Param("uid"))
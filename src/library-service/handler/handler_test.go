@@ -1,7 +1,13 @@
 package handler
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 func TestGetLibrariesByCity(t *testing.T) {
@@ -45,3 +51,54 @@ func TestGetLibraryByUid(t *testing.T) {
 		t.Errorf("Unexpected situation")
 	}
 }
+
+func TestCatalogueRequestValidation(t *testing.T) {
+	book := BookRequest{Name: "  Война и мир  "}
+	if err := book.validate(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if book.Name != "Война и мир" || book.Condition != "EXCELLENT" {
+		t.Errorf("unexpected normalized request %+v", book)
+	}
+
+	if err := (&BookRequest{Name: "book", Condition: "NEW"}).validate(); err == nil {
+		t.Errorf("expected error for unknown condition")
+	}
+	if err := (&LibraryRequest{Name: "library", City: " "}).validate(); err == nil {
+		t.Errorf("expected error for empty city")
+	}
+
+	retired, zero := -1, 0
+	if err := (&CopiesRequest{Delta: &retired}).validate(); err != nil {
+		t.Errorf("unexpected error for retired copies %v", err)
+	}
+	if err := (&CopiesRequest{Delta: &zero}).validate(); err == nil {
+		t.Errorf("expected error for zero delta")
+	}
+	if err := (&CopiesRequest{}).validate(); err == nil {
+		t.Errorf("expected error for missing delta")
+	}
+}
+
+func TestParseUids(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	first, second := uuid.NewString(), uuid.NewString()
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/books?uids="+first+","+second+"&uids="+first, nil)
+
+	uids, err := parseUids(c)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(uids) != 2 || uids[0] != first || uids[1] != second {
+		t.Errorf("unexpected uids %v", uids)
+	}
+
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/books?uids="+url.QueryEscape("x' OR '1'='1"), nil)
+	if _, err := parseUids(c); err == nil {
+		t.Errorf("expected error for invalid uid")
+	}
+}
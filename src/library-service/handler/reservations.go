@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Reservations counts the loans reservation-service has open for a book in a
+// library. authorization is the admin token of the request being served.
+type Reservations interface {
+	ActiveLoans(ctx context.Context, authorization string, libraryUid string, bookUid string) (int, error)
+}
+
+type reservationClient struct {
+	url    string
+	client *http.Client
+}
+
+func NewReservationClient(url string) Reservations {
+	return &reservationClient{url: url, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (r *reservationClient) ActiveLoans(ctx context.Context, authorization string, libraryUid string, bookUid string) (int, error) {
+	query := url.Values{"libraryUid": {libraryUid}, "bookUid": {bookUid}}
+	requestURL := fmt.Sprintf("%s/api/v1/reservations/active?%s", r.url, query.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", authorization)
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("GET %s: %d", requestURL, res.StatusCode)
+	}
+
+	var amount struct {
+		Amount int `json:"amount"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&amount); err != nil {
+		return 0, err
+	}
+
+	return amount.Amount, nil
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"lab2/src/library-service/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LibraryStockResponse struct {
+	Library_uid     string `json:"libraryUid"`
+	Name            string `json:"name"`
+	City            string `json:"city"`
+	Address         string `json:"address"`
+	Available_count int    `json:"availableCount"`
+}
+
+type SearchResultResponse struct {
+	Book_uid  string                 `json:"bookUid"`
+	Name      string                 `json:"name"`
+	Author    string                 `json:"author"`
+	Genre     string                 `json:"genre"`
+	Condition string                 `json:"condition"`
+	Libraries []LibraryStockResponse `json:"libraries"`
+}
+
+func (h *Handler) SearchBooks(c *gin.Context) {
+	query := storage.SearchQuery{
+		Text:      strings.TrimSpace(c.Query("q")),
+		Genre:     c.Query("genre"),
+		Condition: c.Query("condition"),
+		City:      c.Query("city"),
+		Limit:     20,
+	}
+
+	if query.Condition != "" && !bookConditions[query.Condition] {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: "condition must be one of EXCELLENT, GOOD, BAD",
+		})
+		return
+	}
+
+	if available := c.Query("available"); available != "" {
+		value, err := strconv.ParseBool(available)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Message: "invalid available",
+			})
+			return
+		}
+		query.Available = value
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > 100 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Message: "limit must be between 1 and 100",
+			})
+			return
+		}
+		query.Limit = value
+	}
+
+	results, err := h.storage.SearchBooks(context.Background(), query)
+	if err != nil {
+		fmt.Printf("failed to search books %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, SearchResultsToResponse(results))
+}
+
+func SearchResultsToResponse(results []storage.SearchResult) []SearchResultResponse {
+	res := make([]SearchResultResponse, len(results))
+
+	for index, result := range results {
+		libraries := make([]LibraryStockResponse, len(result.Libraries))
+		for i, stock := range result.Libraries {
+			libraries[i] = LibraryStockResponse{
+				Library_uid:     stock.Library_uid,
+				Name:            stock.Name,
+				City:            stock.City,
+				Address:         stock.Address,
+				Available_count: stock.Available_count,
+			}
+		}
+
+		res[index] = SearchResultResponse{
+			Book_uid:  result.Book.Book_uid,
+			Name:      result.Book.Name,
+			Author:    result.Book.Author,
+			Genre:     result.Book.Genre,
+			Condition: result.Book.Condition,
+			Libraries: libraries,
+		}
+	}
+
+	return res
+}
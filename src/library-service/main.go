@@ -3,11 +3,16 @@ package main
 import (
 	"context"
 	"fmt"
+	"log"
+	"time"
 
+	"lab2/src/kafka"
 	"lab2/src/library-service/handler"
 	"lab2/src/library-service/storage"
 	"lab2/src/middleware"
+	"lab2/src/outbox"
 
+	"github.com/IBM/sarama"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
@@ -23,7 +28,15 @@ func main() {
 	}
 	defer psqlDB.Close()
 
-	handler := handler.NewHandler(psqlDB)
+	relay := outbox.NewRelay(psqlDB.Outbox(), func() (sarama.SyncProducer, error) {
+		return kafka.NewSyncProducer([]string{"kafka:9092"})
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go relay.Run(ctx)
+	go purge(ctx, psqlDB)
+
+	handler := handler.NewHandler(psqlDB, handler.NewReservationClient("http://reservation-service:8070"))
 
 	router := gin.Default()
 
@@ -40,12 +53,46 @@ func main() {
 	router.GET("/api/v1/libraries", handler.GetLibrariesByCity)
 	router.GET("/api/v1/libraries/:uid/books/", handler.GetBooksByLibraryUid)
 	router.GET("/api/v1/libraries/:uid/", handler.GetLibraryByUid)
+	router.GET("/api/v1/libraries/:uid/books/:bookUid", handler.GetLibraryBook)
+	router.GET("/api/v1/books", handler.GetBooksByUids)
+	router.GET("/api/v1/books/search", handler.SearchBooks)
 	router.GET("/api/v1/books/:uid/", handler.GetBookInfoByUid)
 
 	router.PUT("/api/v1/books/:uid/condition", jwtMiddleware.Middleware(), handler.UpdateBookCondition)
-	router.PUT("/api/v1/books/:uid/count/:inc/", jwtMiddleware.Middleware(), handler.UpdateBookCount)
+	router.POST("/api/v1/libraries/:uid/books/:bookUid/take", jwtMiddleware.Middleware(), middleware.RequireRole("service", "admin"), handler.TakeBook)
+	router.POST("/api/v1/libraries/:uid/books/:bookUid/return", jwtMiddleware.Middleware(), middleware.RequireRole("service", "admin"), handler.ReturnBook)
+
+	router.POST("/api/v1/libraries", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.CreateLibrary)
+	router.PUT("/api/v1/libraries/:uid", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.UpdateLibrary)
+	router.DELETE("/api/v1/libraries/:uid", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.DeleteLibrary)
+	router.POST("/api/v1/books", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.CreateBook)
+	router.PUT("/api/v1/books/:uid", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.UpdateBook)
+	router.DELETE("/api/v1/books/:uid", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.DeleteBook)
+	router.PUT("/api/v1/libraries/:uid/books/:bookUid", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.SetHolding)
+	router.POST("/api/v1/libraries/:uid/books/:bookUid/copies", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.ChangeCopies)
+	router.DELETE("/api/v1/libraries/:uid/books/:bookUid", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.DeleteHolding)
 
 	router.GET("/manage/health", handler.GetHealth)
 
 	router.Run(":8060")
 }
+
+// purge drops idempotency keys of stock operations past their retention.
+func purge(ctx context.Context, st storage.Storage) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purged, err := st.PurgeStockOperations(ctx, now.UTC().Add(-storage.StockOperationRetention))
+			if err != nil {
+				log.Printf("failed to purge stock operations: %v", err)
+			} else if purged > 0 {
+				log.Printf("purged %d stock operations", purged)
+			}
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"lab2/src/events"
+	"lab2/src/outbox"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Catalogue changes are written together with their event in one
+// transaction, see package outbox.
+
+func (pg *postgres) CreateLibrary(ctx context.Context, actor string, library Library) (Library, error) {
+	library.Library_uid = uuid.New().String()
+
+	query := `INSERT INTO library (library_uid, name, city, address) VALUES ($1, $2, $3, $4) RETURNING id`
+
+	err := pg.inTx(ctx, catalogueEvent(events.LibraryCreated, actor, library.Library_uid, ""), func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, query, library.Library_uid, library.Name, library.City, library.Address).Scan(&library.ID)
+	})
+
+	return library, err
+}
+
+func (pg *postgres) UpdateLibrary(ctx context.Context, actor string, library Library) (Library, error) {
+	query := `UPDATE library SET name = $1, city = $2, address = $3 WHERE library_uid = $4 RETURNING id`
+
+	err := pg.inTx(ctx, catalogueEvent(events.LibraryUpdated, actor, library.Library_uid, ""), func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, query, library.Name, library.City, library.Address, library.Library_uid).Scan(&library.ID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrLibraryNotFound
+		}
+		return err
+	})
+
+	return library, err
+}
+
+func (pg *postgres) DeleteLibrary(ctx context.Context, actor string, libraryUid string) error {
+	return pg.inTx(ctx, catalogueEvent(events.LibraryDeleted, actor, libraryUid, ""), func(tx pgx.Tx) error {
+		var holdings int
+		query := `SELECT COUNT(library_books.book_id) FROM library
+		LEFT JOIN library_books ON library_books.library_id = library.id
+		WHERE library.library_uid = $1 GROUP BY library.id`
+
+		err := tx.QueryRow(ctx, query, libraryUid).Scan(&holdings)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrLibraryNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if holdings > 0 {
+			return ErrInUse
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM library WHERE library_uid = $1`, libraryUid)
+		return err
+	})
+}
+
+func (pg *postgres) CreateBook(ctx context.Context, actor string, book BookInfo) (BookInfo, error) {
+	book.Book_uid = uuid.New().String()
+
+	query := `INSERT INTO books (book_uid, name, author, genre, condition) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+
+	err := pg.inTx(ctx, catalogueEvent(events.BookCreated, actor, "", book.Book_uid), func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, query, book.Book_uid, book.Name, book.Author, book.Genre, book.Condition).Scan(&book.ID)
+	})
+
+	return book, err
+}
+
+func (pg *postgres) UpdateBook(ctx context.Context, actor string, book BookInfo) (BookInfo, error) {
+	query := `UPDATE books SET name = $1, author = $2, genre = $3, condition = $4 WHERE book_uid = $5 RETURNING id`
+
+	err := pg.inTx(ctx, catalogueEvent(events.BookUpdated, actor, "", book.Book_uid), func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, query, book.Name, book.Author, book.Genre, book.Condition, book.Book_uid).Scan(&book.ID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUnknownBook
+		}
+		return err
+	})
+
+	return book, err
+}
+
+func (pg *postgres) DeleteBook(ctx context.Context, actor string, bookUid string) error {
+	return pg.inTx(ctx, catalogueEvent(events.BookDeleted, actor, "", bookUid), func(tx pgx.Tx) error {
+		var holdings int
+		query := `SELECT COUNT(library_books.library_id) FROM books
+		LEFT JOIN library_books ON library_books.book_id = books.id
+		WHERE books.book_uid = $1 GROUP BY books.id`
+
+		err := tx.QueryRow(ctx, query, bookUid).Scan(&holdings)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUnknownBook
+		}
+		if err != nil {
+			return err
+		}
+		if holdings > 0 {
+			return ErrInUse
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM books WHERE book_uid = $1`, bookUid)
+		return err
+	})
+}
+
+// SetHolding links the book to the library without copies, or returns the
+// holding as it is when the link exists. Copies are added and retired with
+// ChangeCopies.
+func (pg *postgres) SetHolding(ctx context.Context, actor string, libraryUid string, bookUid string) (Book, error) {
+	var book Book
+
+	err := pg.inTx(ctx, catalogueEvent(events.HoldingUpdated, actor, libraryUid, bookUid), func(tx pgx.Tx) error {
+		var libraryId int
+		err := tx.QueryRow(ctx, `SELECT id FROM library WHERE library_uid = $1`, libraryUid).Scan(&libraryId)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrLibraryNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		query := `SELECT ` + bookInfoColumns + ` FROM books WHERE book_uid = $1`
+		err = tx.QueryRow(ctx, query, bookUid).Scan(&book.ID, &book.Book_uid, &book.Name, &book.Author, &book.Genre, &book.Condition)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUnknownBook
+		}
+		if err != nil {
+			return err
+		}
+
+		query = `INSERT INTO library_books (book_id, library_id, available_count) VALUES ($1, $2, 0)
+		ON CONFLICT (book_id, library_id) DO UPDATE SET available_count = library_books.available_count
+		RETURNING available_count`
+
+		return tx.QueryRow(ctx, query, book.ID, libraryId).Scan(&book.Available_count)
+	})
+
+	return book, err
+}
+
+// ChangeCopies adds delta copies to a holding, or retires them when delta is
+// negative. Only available copies can be retired, so copies out on loan stay
+// counted; key makes the change idempotent like TakeBook.
+func (pg *postgres) ChangeCopies(ctx context.Context, actor string, libraryUid string, bookUid string, key string, delta int) (int, error) {
+	event := catalogueEvent(events.HoldingUpdated, actor, libraryUid, bookUid)
+	event.Copies = delta
+
+	return pg.changeStock(ctx, libraryUid, bookUid, key, delta, &event)
+}
+
+func (pg *postgres) DeleteHolding(ctx context.Context, actor string, libraryUid string, bookUid string) error {
+	return pg.inTx(ctx, catalogueEvent(events.HoldingDeleted, actor, libraryUid, bookUid), func(tx pgx.Tx) error {
+		query := `DELETE FROM library_books USING books, library
+		WHERE books.id = library_books.book_id AND library.id = library_books.library_id
+		AND library.library_uid = $1 AND books.book_uid = $2`
+
+		tag, err := tx.Exec(ctx, query, libraryUid, bookUid)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrBookNotFound
+		}
+
+		return nil
+	})
+}
+
+func (pg *postgres) Outbox() outbox.Store {
+	return outbox.NewPgStore(pg.db)
+}
+
+// inTx runs fn and records event in one transaction. Errors from fn are
+// returned as they are, so callers can match the storage errors.
+func (pg *postgres) inTx(ctx context.Context, event events.Event, fn func(tx pgx.Tx) error) error {
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	if err = outbox.Add(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func catalogueEvent(eventType events.Type, actor string, libraryUid string, bookUid string) events.Event {
+	event := events.New(eventType, actor)
+	event.LibraryUid = libraryUid
+	event.BookUid = bookUid
+
+	return event
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SearchQuery filters the catalogue. Text matches title and author through
+// full-text search or, for partial words, a trigram backed ILIKE. City keeps
+// books held by a library in that city and Available keeps books with at
+// least one available copy there.
+type SearchQuery struct {
+	Text      string
+	Genre     string
+	Condition string
+	City      string
+	Available bool
+	Limit     int
+}
+
+type LibraryStock struct {
+	Library
+	Available_count int
+}
+
+type SearchResult struct {
+	Book      BookInfo
+	Libraries []LibraryStock
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (pg *postgres) SearchBooks(ctx context.Context, q SearchQuery) ([]SearchResult, error) {
+	query := `WITH matched AS (
+		SELECT books.id, ts_rank(books.search_vector, plainto_tsquery('russian', $1)) AS rank
+		FROM books
+		WHERE ($1 = '' OR books.search_vector @@ plainto_tsquery('russian', $1)
+			OR books.name ILIKE $2 OR books.author ILIKE $2)
+		AND ($3 = '' OR books.genre = $3)
+		AND ($4 = '' OR books.condition = $4)
+		AND ($5 = '' OR EXISTS (SELECT 1 FROM library_books JOIN library ON library.id = library_books.library_id
+			WHERE library_books.book_id = books.id AND library.city = $5))
+		AND (NOT $6 OR EXISTS (SELECT 1 FROM library_books JOIN library ON library.id = library_books.library_id
+			WHERE library_books.book_id = books.id AND library_books.available_count > 0 AND ($5 = '' OR library.city = $5)))
+		ORDER BY rank DESC, books.name
+		LIMIT $7
+	)
+	SELECT ` + bookInfoColumns + `, COALESCE(library.id, 0), COALESCE(library.library_uid::text, ''),
+		COALESCE(library.name, ''), COALESCE(library.city, ''), COALESCE(library.address, ''),
+		COALESCE(library_books.available_count, 0)
+	FROM matched
+	JOIN books ON books.id = matched.id
+	LEFT JOIN (library_books JOIN library ON library.id = library_books.library_id)
+		ON library_books.book_id = books.id AND library_books.available_count > 0 AND ($5 = '' OR library.city = $5)
+	ORDER BY matched.rank DESC, books.name, books.id, library.name`
+
+	pattern := "%" + likeEscaper.Replace(q.Text) + "%"
+
+	rows, err := pg.db.Query(ctx, query, q.Text, pattern, q.Genre, q.Condition, q.City, q.Available, q.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]SearchResult, 0)
+	for rows.Next() {
+		var book BookInfo
+		var stock LibraryStock
+
+		err := rows.Scan(&book.ID, &book.Book_uid, &book.Name, &book.Author, &book.Genre, &book.Condition,
+			&stock.ID, &stock.Library_uid, &stock.Name, &stock.City, &stock.Address, &stock.Available_count)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+
+		if len(results) == 0 || results[len(results)-1].Book.ID != book.ID {
+			results = append(results, SearchResult{Book: book, Libraries: make([]LibraryStock, 0)})
+		}
+		if stock.ID != 0 {
+			last := &results[len(results)-1]
+			last.Libraries = append(last.Libraries, stock)
+		}
+	}
+
+	return results, rows.Err()
+}
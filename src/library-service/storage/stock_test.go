@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"lab2/src/pgtest"
+
+	"github.com/google/uuid"
+)
+
+// holding stores a library holding copies of a new book and returns their
+// uids.
+func holding(t *testing.T, conn *pgtest.Conn, copies int) (string, string) {
+	t.Helper()
+	ctx := context.Background()
+
+	libraryUid, bookUid := uuid.New().String(), uuid.New().String()
+
+	var libraryId, bookId int
+	err := conn.QueryRow(ctx, `INSERT INTO library (library_uid, name, city, address) VALUES ($1, 'Тестовая', 'Москва', 'ул. Тестовая, 1') RETURNING id`,
+		libraryUid).Scan(&libraryId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.QueryRow(ctx, `INSERT INTO books (book_uid, name, author, genre) VALUES ($1, 'Тестовая книга', 'Автор', 'Роман') RETURNING id`,
+		bookUid).Scan(&bookId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(ctx, `INSERT INTO library_books (book_id, library_id, available_count) VALUES ($1, $2, $3)`,
+		bookId, libraryId, copies)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return libraryUid, bookUid
+}
+
+func TestTakeAndReturnBook(t *testing.T) {
+	conn := pgtest.Open(t, "libraries")
+	pg := &postgres{db: conn}
+	ctx := context.Background()
+
+	libraryUid, bookUid := holding(t, conn, 1)
+
+	if count, err := pg.TakeBook(ctx, libraryUid, bookUid, "take:"+uuid.New().String()); err != nil || count != 0 {
+		t.Fatalf("expected the last copy to be taken, got %d, %v", count, err)
+	}
+	if _, err := pg.TakeBook(ctx, libraryUid, bookUid, "take:"+uuid.New().String()); !errors.Is(err, ErrOutOfStock) {
+		t.Fatalf("expected ErrOutOfStock, got %v", err)
+	}
+
+	key := "return:" + uuid.New().String()
+	if count, err := pg.ReturnBook(ctx, libraryUid, bookUid, key); err != nil || count != 1 {
+		t.Fatalf("expected the copy to be returned, got %d, %v", count, err)
+	}
+	if count, err := pg.ReturnBook(ctx, libraryUid, bookUid, key); err != nil || count != 1 {
+		t.Fatalf("expected a repeated return to change nothing, got %d, %v", count, err)
+	}
+	if _, err := pg.TakeBook(ctx, libraryUid, bookUid, key); !errors.Is(err, ErrKeyReused) {
+		t.Fatalf("expected ErrKeyReused for a take under a return key, got %v", err)
+	}
+}
+
+func TestTakeUnknownBook(t *testing.T) {
+	conn := pgtest.Open(t, "libraries")
+	pg := &postgres{db: conn}
+
+	libraryUid, _ := holding(t, conn, 1)
+
+	if _, err := pg.TakeBook(context.Background(), libraryUid, uuid.New().String(), ""); !errors.Is(err, ErrBookNotFound) {
+		t.Fatalf("expected ErrBookNotFound, got %v", err)
+	}
+}
@@ -2,10 +2,17 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
+
+	"lab2/src/events"
+	"lab2/src/outbox"
+	"lab2/src/pagination"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -36,20 +43,78 @@ type BookInfo struct {
 	Condition string `json:"condition"`
 }
 
+var (
+	ErrBookNotFound    = errors.New("book not found in library")
+	ErrOutOfStock      = errors.New("no copies available")
+	ErrLibraryNotFound = errors.New("library not found")
+	ErrUnknownBook     = errors.New("book not found")
+	ErrInUse           = errors.New("still held by a library")
+	ErrKeyReused       = errors.New("idempotency key was used for another stock operation")
+)
+
+// StockOperationRetention is how long idempotency keys of stock operations are
+// kept. It outlives the deadline of the gateway jobs that repeat them.
+const StockOperationRetention = 7 * 24 * time.Hour
+
 type Storage interface {
-	GetLibrariesByCity(ctx context.Context, city string) ([]Library, error)
-	GetBooksByLibraryUid(ctx context.Context, libraryUid string, showAll bool) ([]Book, error)
-	GetBookByUid(ctx context.Context, bookUid string) (Book, error)
+	GetLibrariesByCity(ctx context.Context, city string, page pagination.Page) ([]Library, int, error)
+	GetBooksByLibraryUid(ctx context.Context, libraryUid string, showAll bool, page pagination.Page) ([]Book, int, error)
+	GetLibraryBook(ctx context.Context, libraryUid string, bookUid string) (Book, error)
 	GetBookInfoByUid(ctx context.Context, bookUid string) (BookInfo, error)
 	GetLibraryByUid(ctx context.Context, libraryUid string) (Library, error)
-	UpdateBookCount(ctx context.Context, bookId int, count int) error
+	GetLibrariesByUids(ctx context.Context, libraryUids []string) ([]Library, error)
+	GetBooksByUids(ctx context.Context, bookUids []string) ([]BookInfo, error)
+	TakeBook(ctx context.Context, libraryUid string, bookUid string, key string) (int, error)
+	ReturnBook(ctx context.Context, libraryUid string, bookUid string, key string) (int, error)
+	PurgeStockOperations(ctx context.Context, before time.Time) (int, error)
 	UpdateBookCondition(ctx context.Context, bookUid string, condition string) error
+	SearchBooks(ctx context.Context, q SearchQuery) ([]SearchResult, error)
+
+	CreateLibrary(ctx context.Context, actor string, library Library) (Library, error)
+	UpdateLibrary(ctx context.Context, actor string, library Library) (Library, error)
+	DeleteLibrary(ctx context.Context, actor string, libraryUid string) error
+	CreateBook(ctx context.Context, actor string, book BookInfo) (BookInfo, error)
+	UpdateBook(ctx context.Context, actor string, book BookInfo) (BookInfo, error)
+	DeleteBook(ctx context.Context, actor string, bookUid string) error
+	SetHolding(ctx context.Context, actor string, libraryUid string, bookUid string) (Book, error)
+	ChangeCopies(ctx context.Context, actor string, libraryUid string, bookUid string, key string, delta int) (int, error)
+	DeleteHolding(ctx context.Context, actor string, libraryUid string, bookUid string) error
+}
+
+// database is implemented by *pgxpool.Pool; tests replace it with a
+// pgtest.Recorder.
+type database interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Ping(ctx context.Context) error
+	Close()
 }
 
 type postgres struct {
-	db *pgxpool.Pool
+	db database
 }
 
+const (
+	libraryColumns  = `library.id, library.library_uid, library.name, library.city, library.address`
+	bookInfoColumns = `books.id, books.book_uid, books.name, books.author, books.genre, books.condition`
+	bookColumns     = bookInfoColumns + `, library_books.available_count`
+)
+
+var (
+	LibrarySortColumns = pagination.Columns{
+		"name":    "library.name",
+		"address": "library.address",
+	}
+	BookSortColumns = pagination.Columns{
+		"name":           "books.name",
+		"author":         "books.author",
+		"genre":          "books.genre",
+		"availableCount": "library_books.available_count",
+	}
+)
+
 func NewPgStorage(ctx context.Context, connString string) (*postgres, error) {
 	var pgInstance *postgres
 	var pgOnce sync.Once
@@ -74,64 +139,74 @@ func (pg *postgres) Close() {
 	pg.db.Close()
 }
 
-func (pg *postgres) GetLibrariesByCity(ctx context.Context, city string) ([]Library, error) {
-	query := fmt.Sprintf(`SELECT id, library_uid, name, city, address FROM library WHERE city = '%s'`, city)
+func (pg *postgres) GetLibrariesByCity(ctx context.Context, city string, page pagination.Page) ([]Library, int, error) {
+	var total int
+	err := pg.db.QueryRow(ctx, `SELECT COUNT(*) FROM library WHERE city = $1`, city).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to count: %w", err)
+	}
+
+	query := `SELECT ` + libraryColumns + ` FROM library WHERE city = $1
+	` + page.OrderBy(LibrarySortColumns, "library.id") + ` LIMIT $2 OFFSET $3`
 
-	rows, err := pg.db.Query(ctx, query)
+	rows, err := pg.db.Query(ctx, query, city, page.Size, page.Offset())
 
 	var libraries []Library
 
 	if err != nil {
-		return libraries, fmt.Errorf("unable to query: %w", err)
+		return libraries, 0, fmt.Errorf("unable to query: %w", err)
 	}
 	defer rows.Close()
 
 	libraries, err = pgx.CollectRows(rows, pgx.RowToStructByName[Library])
 	if err != nil {
 		fmt.Printf("CollectRows error: %v", err)
-		return libraries, err
+		return libraries, 0, err
 	}
 
-	return libraries, nil
+	return libraries, total, nil
 }
 
-func (pg *postgres) GetBooksByLibraryUid(ctx context.Context, libraryUid string, showAll bool) ([]Book, error) {
-	query := ""
-	if showAll {
-		query = fmt.Sprintf(`SELECT books.*, library_books.available_count from library_books, books, library 
-	where library.library_uid = '%s' and library.id = library_books.library_id 
-	and books.id = library_books.book_id;`, libraryUid)
-	} else {
-		query = fmt.Sprintf(`SELECT books.*, library_books.available_count from library_books, books, library 
-	where library.library_uid = '%s' and library.id = library_books.library_id 
-	and books.id = library_books.book_id and library_books.available_count > 0;`, libraryUid)
+func (pg *postgres) GetBooksByLibraryUid(ctx context.Context, libraryUid string, showAll bool, page pagination.Page) ([]Book, int, error) {
+	from := ` FROM library_books
+	JOIN books ON books.id = library_books.book_id
+	JOIN library ON library.id = library_books.library_id
+	WHERE library.library_uid = $1 AND ($2 OR library_books.available_count > 0)`
+
+	var total int
+	err := pg.db.QueryRow(ctx, `SELECT COUNT(*)`+from, libraryUid, showAll).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to count: %w", err)
 	}
 
-	rows, err := pg.db.Query(ctx, query)
+	query := `SELECT ` + bookColumns + from + `
+	` + page.OrderBy(BookSortColumns, "books.id") + ` LIMIT $3 OFFSET $4`
+
+	rows, err := pg.db.Query(ctx, query, libraryUid, showAll, page.Size, page.Offset())
 
 	var books []Book
 
 	if err != nil {
-		return books, fmt.Errorf("unable to query: %w", err)
+		return books, 0, fmt.Errorf("unable to query: %w", err)
 	}
 	defer rows.Close()
 
 	books, err = pgx.CollectRows(rows, pgx.RowToStructByName[Book])
 	if err != nil {
 		fmt.Printf("CollectRows error: %v", err)
-		return books, err
+		return books, 0, err
 	}
 
-	return books, nil
+	return books, total, nil
 }
 
-func (pg *postgres) GetBookByUid(ctx context.Context, bookUid string) (Book, error) {
-
-	query := fmt.Sprintf(`SELECT books.*, library_books.available_count from library_books, books, library 
-	where books.book_uid = '%s' and library.id = library_books.library_id 
-	and books.id = library_books.book_id;`, bookUid)
+func (pg *postgres) GetLibraryBook(ctx context.Context, libraryUid string, bookUid string) (Book, error) {
+	query := `SELECT ` + bookColumns + ` FROM library_books
+	JOIN books ON books.id = library_books.book_id
+	JOIN library ON library.id = library_books.library_id
+	WHERE library.library_uid = $1 AND books.book_uid = $2`
 
-	rows, err := pg.db.Query(ctx, query)
+	rows, err := pg.db.Query(ctx, query, libraryUid, bookUid)
 
 	var book Book
 
@@ -150,10 +225,9 @@ func (pg *postgres) GetBookByUid(ctx context.Context, bookUid string) (Book, err
 }
 
 func (pg *postgres) GetBookInfoByUid(ctx context.Context, bookUid string) (BookInfo, error) {
+	query := `SELECT ` + bookInfoColumns + ` FROM books WHERE book_uid = $1`
 
-	query := fmt.Sprintf(`SELECT * FROM books WHERE book_uid = '%s'`, bookUid)
-
-	rows, err := pg.db.Query(ctx, query)
+	rows, err := pg.db.Query(ctx, query, bookUid)
 
 	var book BookInfo
 
@@ -172,10 +246,9 @@ func (pg *postgres) GetBookInfoByUid(ctx context.Context, bookUid string) (BookI
 }
 
 func (pg *postgres) GetLibraryByUid(ctx context.Context, libraryUid string) (Library, error) {
+	query := `SELECT ` + libraryColumns + ` FROM library WHERE library_uid = $1`
 
-	query := fmt.Sprintf(`SELECT id, library_uid, name, city, address FROM library WHERE library_uid = '%s'`, libraryUid)
-
-	rows, err := pg.db.Query(ctx, query)
+	rows, err := pg.db.Query(ctx, query, libraryUid)
 
 	var library Library
 
@@ -193,21 +266,148 @@ func (pg *postgres) GetLibraryByUid(ctx context.Context, libraryUid string) (Lib
 	return library, nil
 }
 
-func (pg *postgres) UpdateBookCount(ctx context.Context, bookId int, count int) error {
-	query := fmt.Sprintf(`UPDATE library_books SET available_count = %d WHERE book_id = %d`, count, bookId)
+func (pg *postgres) GetLibrariesByUids(ctx context.Context, libraryUids []string) ([]Library, error) {
+	query := `SELECT ` + libraryColumns + ` FROM library WHERE library_uid = ANY($1::uuid[])`
+
+	rows, err := pg.db.Query(ctx, query, libraryUids)
+
+	var libraries []Library
 
-	_, err := pg.db.Exec(ctx, query)
 	if err != nil {
-		return fmt.Errorf("unable to insert row: %w", err)
+		return libraries, fmt.Errorf("unable to query: %w", err)
 	}
+	defer rows.Close()
 
-	return nil
+	libraries, err = pgx.CollectRows(rows, pgx.RowToStructByName[Library])
+	if err != nil {
+		fmt.Printf("CollectRows error: %v", err)
+		return libraries, err
+	}
+
+	return libraries, nil
+}
+
+func (pg *postgres) GetBooksByUids(ctx context.Context, bookUids []string) ([]BookInfo, error) {
+	query := `SELECT ` + bookInfoColumns + ` FROM books WHERE book_uid = ANY($1::uuid[])`
+
+	rows, err := pg.db.Query(ctx, query, bookUids)
+
+	var books []BookInfo
+
+	if err != nil {
+		return books, fmt.Errorf("unable to query: %w", err)
+	}
+	defer rows.Close()
+
+	books, err = pgx.CollectRows(rows, pgx.RowToStructByName[BookInfo])
+	if err != nil {
+		fmt.Printf("CollectRows error: %v", err)
+		return books, err
+	}
+
+	return books, nil
+}
+
+// TakeBook takes one copy of the book in the library and returns the copies
+// left, or ErrOutOfStock when there are none. A non-empty key makes the call
+// idempotent: a repeated key changes nothing and returns the current count,
+// while reusing a key for another book or direction fails with ErrKeyReused.
+func (pg *postgres) TakeBook(ctx context.Context, libraryUid string, bookUid string, key string) (int, error) {
+	return pg.changeStock(ctx, libraryUid, bookUid, key, -1, nil)
+}
+
+// ReturnBook puts one copy back, with the same key semantics as TakeBook.
+func (pg *postgres) ReturnBook(ctx context.Context, libraryUid string, bookUid string, key string) (int, error) {
+	return pg.changeStock(ctx, libraryUid, bookUid, key, 1, nil)
+}
+
+// changeStock adds delta copies, failing with ErrOutOfStock instead of going
+// below zero. event, when given, is recorded with the change.
+func (pg *postgres) changeStock(ctx context.Context, libraryUid string, bookUid string, key string, delta int, event *events.Event) (int, error) {
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if key != "" {
+		query := `INSERT INTO stock_operations (operation_key, library_uid, book_uid, delta, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (operation_key) DO NOTHING`
+
+		tag, err := tx.Exec(ctx, query, key, libraryUid, bookUid, delta, time.Now().UTC())
+		if err != nil {
+			return 0, fmt.Errorf("unable to insert row: %w", err)
+		}
+
+		//already applied
+		if tag.RowsAffected() == 0 {
+			var same bool
+			query = `SELECT library_uid = $2::uuid AND book_uid = $3::uuid AND delta = $4
+			FROM stock_operations WHERE operation_key = $1`
+
+			if err = tx.QueryRow(ctx, query, key, libraryUid, bookUid, delta).Scan(&same); err != nil {
+				return 0, fmt.Errorf("unable to query: %w", err)
+			}
+			if !same {
+				return 0, ErrKeyReused
+			}
+
+			book, err := pg.GetLibraryBook(ctx, libraryUid, bookUid)
+			return book.Available_count, err
+		}
+	}
+
+	query := `UPDATE library_books SET available_count = available_count + $1
+	FROM books, library
+	WHERE books.id = library_books.book_id AND library.id = library_books.library_id
+	AND library.library_uid = $2 AND books.book_uid = $3 AND library_books.available_count + $1 >= 0
+	RETURNING library_books.available_count`
+
+	var count int
+	err = tx.QueryRow(ctx, query, delta, libraryUid, bookUid).Scan(&count)
+	if errors.Is(err, pgx.ErrNoRows) {
+		_, err = pg.GetLibraryBook(ctx, libraryUid, bookUid)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrBookNotFound
+		}
+		if err != nil {
+			return 0, err
+		}
+		return 0, ErrOutOfStock
+	}
+	if err != nil {
+		return 0, fmt.Errorf("unable to update row: %w", err)
+	}
+
+	if event != nil {
+		if err = outbox.Add(ctx, tx, *event); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
+	return count, nil
+}
+
+// PurgeStockOperations forgets idempotency keys recorded before before and
+// returns how many were removed.
+func (pg *postgres) PurgeStockOperations(ctx context.Context, before time.Time) (int, error) {
+	tag, err := pg.db.Exec(ctx, `DELETE FROM stock_operations WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("unable to delete rows: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
 }
 
 func (pg *postgres) UpdateBookCondition(ctx context.Context, bookUid string, condition string) error {
-	query := fmt.Sprintf(`UPDATE books SET condition = '%s' WHERE book_id = '%s'`, condition, bookUid)
+	query := `UPDATE books SET condition = $1 WHERE book_uid = $2`
 
-	_, err := pg.db.Exec(ctx, query)
+	_, err := pg.db.Exec(ctx, query, condition, bookUid)
 	if err != nil {
 		return fmt.Errorf("unable to insert row: %w", err)
 	}
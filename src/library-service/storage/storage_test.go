@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"lab2/src/pagination"
+	"lab2/src/pgtest"
+)
+
+const injection = `x' OR '1'='1'; DROP TABLE books; --`
+
+func TestQueriesBindUserInput(t *testing.T) {
+	page := pagination.Page{Number: 1, Size: 10, Sort: "name"}
+
+	cases := map[string]func(pg *postgres) error{
+		"GetLibrariesByCity": func(pg *postgres) error {
+			_, _, err := pg.GetLibrariesByCity(context.Background(), injection, page)
+			return err
+		},
+		"GetBooksByLibraryUid": func(pg *postgres) error {
+			_, _, err := pg.GetBooksByLibraryUid(context.Background(), injection, true, page)
+			return err
+		},
+		"GetLibraryBook": func(pg *postgres) error {
+			_, err := pg.GetLibraryBook(context.Background(), "library", injection)
+			return err
+		},
+		"TakeBook": func(pg *postgres) error {
+			_, err := pg.TakeBook(context.Background(), injection, "book", "")
+			return err
+		},
+		"ReturnBook": func(pg *postgres) error {
+			_, err := pg.ReturnBook(context.Background(), "library", "book", injection)
+			return err
+		},
+		"GetBookInfoByUid": func(pg *postgres) error {
+			_, err := pg.GetBookInfoByUid(context.Background(), injection)
+			return err
+		},
+		"GetLibrariesByUids": func(pg *postgres) error {
+			_, err := pg.GetLibrariesByUids(context.Background(), []string{"library", injection})
+			return err
+		},
+		"GetBooksByUids": func(pg *postgres) error {
+			_, err := pg.GetBooksByUids(context.Background(), []string{injection})
+			return err
+		},
+		"GetLibraryByUid": func(pg *postgres) error {
+			_, err := pg.GetLibraryByUid(context.Background(), injection)
+			return err
+		},
+		"UpdateBookCondition": func(pg *postgres) error {
+			return pg.UpdateBookCondition(context.Background(), injection, "GOOD")
+		},
+	}
+
+	for name, call := range cases {
+		t.Run(name, func(t *testing.T) {
+			recorder := &pgtest.Recorder{}
+			if err := call(&postgres{db: recorder}); err == nil {
+				t.Fatal("expected recorded error")
+			}
+			recorder.AssertBound(t, injection)
+		})
+	}
+}
+
+func TestSearchBindsUserInput(t *testing.T) {
+	recorder := &pgtest.Recorder{}
+	pg := &postgres{db: recorder}
+
+	_, err := pg.SearchBooks(context.Background(), SearchQuery{City: injection, Limit: 20})
+	if err == nil {
+		t.Fatal("expected recorded error")
+	}
+	recorder.AssertBound(t, injection)
+
+	recorder = &pgtest.Recorder{}
+	pg = &postgres{db: recorder}
+	pg.SearchBooks(context.Background(), SearchQuery{Text: "100%_off", Limit: 20})
+	if pattern := recorder.Statements[0].Args[1]; pattern != `%100\%\_off%` {
+		t.Fatalf("expected escaped like pattern, got %v", pattern)
+	}
+}
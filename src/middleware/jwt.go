@@ -9,6 +9,7 @@ import (
 	"log"
 	"math/big"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -29,6 +30,10 @@ type JWK struct {
 	Alg string `json:"alg"`
 }
 
+// ActingUserHeader names the reader a service token acts for. It is honoured
+// only for tokens with the service role and the delegate scope.
+const ActingUserHeader = "X-Acting-User"
+
 type JWTMiddleware struct {
 	idpURL     string
 	publicKeys map[string]*rsa.PublicKey
@@ -172,6 +177,13 @@ func (jm *JWTMiddleware) Middleware() gin.HandlerFunc {
 		c.Set("user_id", claims["sub"])
 		c.Set("username", claims["preferred_username"])
 		c.Set("role", claims["role"])
+		c.Set("scope", claims["scope"])
+
+		if claims["role"] == "service" {
+			if actor := c.GetHeader(ActingUserHeader); actor != "" && contains(strings.Fields(c.GetString("scope")), "delegate") {
+				c.Set("username", actor)
+			}
+		}
 
 		c.Next()
 	}
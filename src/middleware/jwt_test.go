@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newIdp serves the JWKS of a fresh key and returns a signer for tokens.
+func newIdp(t *testing.T) (*httptest.Server, func(claims jwt.MapClaims) string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{{
+			Kty: "RSA",
+			Kid: "test",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(server.Close)
+
+	sign := func(claims jwt.MapClaims) string {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		return signed
+	}
+
+	return server, sign
+}
+
+// username returns the username the middleware stored for a request.
+func username(t *testing.T, jm *JWTMiddleware, token string, actor string) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	var got string
+	router := gin.New()
+	router.GET("/", jm.Middleware(), func(c *gin.Context) {
+		got = c.GetString("username")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if actor != "" {
+		req.Header.Set(ActingUserHeader, actor)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+
+	return got
+}
+
+func TestActingUser(t *testing.T) {
+	server, sign := newIdp(t)
+	jm := NewJWTMiddleware(server.URL)
+
+	service := sign(jwt.MapClaims{"preferred_username": "gateway", "role": "service", "scope": "delegate"})
+	if got := username(t, jm, service, "reader"); got != "reader" {
+		t.Fatalf("expected service to act for reader, got %q", got)
+	}
+	if got := username(t, jm, service, ""); got != "gateway" {
+		t.Fatalf("expected service identity without header, got %q", got)
+	}
+
+	undelegated := sign(jwt.MapClaims{"preferred_username": "gateway", "role": "service", "scope": "openid"})
+	if got := username(t, jm, undelegated, "reader"); got != "gateway" {
+		t.Fatalf("expected header to need the delegate scope, got %q", got)
+	}
+
+	user := sign(jwt.MapClaims{"preferred_username": "user", "role": "user", "scope": "delegate"})
+	if got := username(t, jm, user, "admin"); got != "user" {
+		t.Fatalf("expected readers not to impersonate, got %q", got)
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole lets the request through only when the role claim stored by
+// JWTMiddleware matches one of roles. It must be chained after Middleware().
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := c.Get("role")
+
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient role"})
+		c.Abort()
+	}
+}
+
+// RequireScope lets the request through only when the space separated scope
+// claim contains every one of scopes. It must be chained after Middleware().
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := strings.Fields(c.GetString("scope"))
+
+		for _, required := range scopes {
+			if !contains(granted, required) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "insufficient scope"})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func serve(claims map[string]any, guard gin.HandlerFunc) int {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/", func(c *gin.Context) {
+		for key, value := range claims {
+			c.Set(key, value)
+		}
+	}, guard, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	return rec.Code
+}
+
+func TestRequireRole(t *testing.T) {
+	if code := serve(map[string]any{"role": "admin"}, RequireRole("admin")); code != http.StatusOK {
+		t.Fatalf("expected admin to pass, got %d", code)
+	}
+	if code := serve(map[string]any{"role": "user"}, RequireRole("admin")); code != http.StatusForbidden {
+		t.Fatalf("expected user to be forbidden, got %d", code)
+	}
+	if code := serve(nil, RequireRole("admin")); code != http.StatusForbidden {
+		t.Fatalf("expected missing role to be forbidden, got %d", code)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	claims := map[string]any{"scope": "openid profile"}
+
+	if code := serve(claims, RequireScope("openid", "profile")); code != http.StatusOK {
+		t.Fatalf("expected granted scopes to pass, got %d", code)
+	}
+	if code := serve(claims, RequireScope("email")); code != http.StatusForbidden {
+		t.Fatalf("expected missing scope to be forbidden, got %d", code)
+	}
+}
@@ -0,0 +1,181 @@
+// Package outbox implements the transactional outbox: services write events
+// into an outbox table in the same transaction as their own changes, and a
+// Relay publishes the stored rows to Kafka. Delivery is at least once, so
+// consumers deduplicate by event ID.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"lab2/src/events"
+
+	"github.com/IBM/sarama"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type Message struct {
+	ID        int64
+	EventID   string
+	Topic     string
+	Key       string
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+type Store interface {
+	Pending(ctx context.Context, limit int) ([]Message, error)
+	MarkSent(ctx context.Context, id int64) error
+}
+
+// Add stores event in the outbox as part of tx.
+func Add(ctx context.Context, tx pgx.Tx, event events.Event) error {
+	payload, err := event.Encode()
+	if err != nil {
+		return fmt.Errorf("unable to encode event: %w", err)
+	}
+
+	query := `INSERT INTO outbox (event_id, topic, key, payload, created_at) VALUES ($1, $2, $3, $4, $5)`
+
+	_, err = tx.Exec(ctx, query, event.ID, events.Topic, event.Key(), payload, event.OccurredAt)
+	if err != nil {
+		return fmt.Errorf("unable to insert outbox row: %w", err)
+	}
+
+	return nil
+}
+
+// DB is implemented by *pgxpool.Pool.
+type DB interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+type PgStore struct {
+	db DB
+}
+
+func NewPgStore(db DB) *PgStore {
+	return &PgStore{db: db}
+}
+
+func (ps *PgStore) Pending(ctx context.Context, limit int) ([]Message, error) {
+	query := `SELECT id, event_id, topic, key, payload, created_at FROM outbox
+	WHERE sent_at IS NULL ORDER BY id LIMIT $1`
+
+	rows, err := ps.db.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query: %w", err)
+	}
+	defer rows.Close()
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Message, error) {
+		var msg Message
+		err := row.Scan(&msg.ID, &msg.EventID, &msg.Topic, &msg.Key, &msg.Payload, &msg.CreatedAt)
+		return msg, err
+	})
+}
+
+func (ps *PgStore) MarkSent(ctx context.Context, id int64) error {
+	_, err := ps.db.Exec(ctx, `UPDATE outbox SET sent_at = $1 WHERE id = $2`, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("unable to update row: %w", err)
+	}
+
+	return nil
+}
+
+// Relay moves outbox rows to Kafka in insertion order. A row is marked sent
+// only after Kafka acknowledged it, so a failed send is retried on the next
+// tick and later rows wait behind it.
+type Relay struct {
+	Interval  time.Duration
+	BatchSize int
+
+	store    Store
+	connect  func() (sarama.SyncProducer, error)
+	producer sarama.SyncProducer
+}
+
+// NewRelay returns a relay that opens its producer through connect on first
+// use, and again after the producer is closed by a failed send. This keeps
+// events in the table while Kafka is unreachable at startup.
+func NewRelay(store Store, connect func() (sarama.SyncProducer, error)) *Relay {
+	return &Relay{
+		Interval:  time.Second,
+		BatchSize: 100,
+		store:     store,
+		connect:   connect,
+	}
+}
+
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Flush(ctx); err != nil {
+			fmt.Printf("outbox relay: %s\n", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			r.Close()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush publishes pending rows until the outbox is empty or a send fails and
+// returns the number of published rows.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	sent := 0
+
+	for {
+		messages, err := r.store.Pending(ctx, r.BatchSize)
+		if err != nil {
+			return sent, err
+		}
+		if len(messages) == 0 {
+			return sent, nil
+		}
+
+		if r.producer == nil {
+			r.producer, err = r.connect()
+			if err != nil {
+				return sent, err
+			}
+		}
+
+		for _, msg := range messages {
+			_, _, err := r.producer.SendMessage(&sarama.ProducerMessage{
+				Topic: msg.Topic,
+				Key:   sarama.StringEncoder(msg.Key),
+				Value: sarama.ByteEncoder(msg.Payload),
+			})
+			if err != nil {
+				r.Close()
+				return sent, fmt.Errorf("failed to send event %s: %w", msg.EventID, err)
+			}
+
+			if err := r.store.MarkSent(ctx, msg.ID); err != nil {
+				return sent, err
+			}
+			sent++
+		}
+	}
+}
+
+func (r *Relay) Close() {
+	if r.producer == nil {
+		return
+	}
+
+	if err := r.producer.Close(); err != nil {
+		fmt.Printf("failed to close kafka producer: %s\n", err.Error())
+	}
+	r.producer = nil
+}
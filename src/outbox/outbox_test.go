@@ -0,0 +1,72 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+type memoryStore struct {
+	messages []Message
+	sent     map[int64]bool
+}
+
+func (ms *memoryStore) Pending(_ context.Context, limit int) ([]Message, error) {
+	pending := make([]Message, 0)
+	for _, msg := range ms.messages {
+		if ms.sent[msg.ID] {
+			continue
+		}
+		pending = append(pending, msg)
+		if len(pending) == limit {
+			break
+		}
+	}
+
+	return pending, nil
+}
+
+func (ms *memoryStore) MarkSent(_ context.Context, id int64) error {
+	ms.sent[id] = true
+	return nil
+}
+
+func TestRelayKeepsRowsUntilSent(t *testing.T) {
+	store := &memoryStore{sent: make(map[int64]bool)}
+	for i := int64(1); i <= 3; i++ {
+		store.messages = append(store.messages, Message{ID: i, Topic: "events", Payload: []byte("{}")})
+	}
+
+	first := mocks.NewSyncProducer(t, nil)
+	first.ExpectSendMessageAndSucceed()
+	first.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+
+	second := mocks.NewSyncProducer(t, nil)
+	second.ExpectSendMessageAndSucceed()
+	second.ExpectSendMessageAndSucceed()
+
+	producers := []sarama.SyncProducer{first, second}
+	relay := NewRelay(store, func() (sarama.SyncProducer, error) {
+		producer := producers[0]
+		producers = producers[1:]
+		return producer, nil
+	})
+	relay.BatchSize = 2
+
+	sent, err := relay.Flush(context.Background())
+	if !errors.Is(err, sarama.ErrOutOfBrokers) || sent != 1 {
+		t.Fatalf("expected one sent row and a send error, got %d, %v", sent, err)
+	}
+	if store.sent[2] {
+		t.Fatal("failed row was marked sent")
+	}
+
+	sent, err = relay.Flush(context.Background())
+	if err != nil || sent != 2 {
+		t.Fatalf("expected remaining rows to be sent, got %d, %v", sent, err)
+	}
+	relay.Close()
+}
@@ -0,0 +1,117 @@
+// Package pagination parses the page, size and sort query parameters shared
+// by the list endpoints and builds the matching ORDER BY/LIMIT/OFFSET clause.
+//
+// Pages are numbered from 1. Sort is "field" or "field,asc|desc", where field
+// is one of the API names the endpoint allows; the SQL column behind it comes
+// from the endpoint's whitelist and never from the request.
+package pagination
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultSize = 100
+	MaxSize     = 100
+)
+
+var (
+	ErrInvalidPage = errors.New("page must be a positive integer")
+	ErrInvalidSize = errors.New("size must be between 1 and 100")
+)
+
+// Columns maps the sort fields accepted by an endpoint to SQL expressions.
+type Columns map[string]string
+
+type Page struct {
+	Number int
+	Size   int
+	Sort   string
+	Desc   bool
+}
+
+// Parse reads page, size and sort as given in the query string. Empty values
+// fall back to the first page, DefaultSize and defaultSort ascending.
+func Parse(page, size, sort string, columns Columns, defaultSort string) (Page, error) {
+	p := Page{Number: 1, Size: DefaultSize, Sort: defaultSort}
+
+	if page != "" {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return p, ErrInvalidPage
+		}
+		p.Number = n
+	}
+
+	if size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 1 || n > MaxSize {
+			return p, ErrInvalidSize
+		}
+		p.Size = n
+	}
+
+	if sort != "" {
+		field, direction, _ := strings.Cut(sort, ",")
+		if _, ok := columns[field]; !ok {
+			return p, fmt.Errorf("unknown sort field %q", field)
+		}
+		p.Sort = field
+
+		switch strings.ToLower(direction) {
+		case "", "asc":
+		case "desc":
+			p.Desc = true
+		default:
+			return p, fmt.Errorf("unknown sort direction %q", direction)
+		}
+	}
+
+	return p, nil
+}
+
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.Size
+}
+
+// OrderBy returns the ORDER BY clause for the page. The tiebreak column keeps
+// the order stable between pages when sort values repeat.
+func (p Page) OrderBy(columns Columns, tiebreak string) string {
+	direction := "ASC"
+	if p.Desc {
+		direction = "DESC"
+	}
+	return fmt.Sprintf("ORDER BY %s %s, %s", columns[p.Sort], direction, tiebreak)
+}
+
+func TotalPages(total int, size int) int {
+	if size <= 0 {
+		return 0
+	}
+	return (total + size - 1) / size
+}
+
+// Response is the JSON envelope returned by paginated endpoints.
+type Response[T any] struct {
+	Page          int `json:"page"`
+	PageSize      int `json:"pageSize"`
+	TotalElements int `json:"totalElements"`
+	TotalPages    int `json:"totalPages"`
+	Items         []T `json:"items"`
+}
+
+func NewResponse[T any](p Page, total int, items []T) Response[T] {
+	if items == nil {
+		items = make([]T, 0)
+	}
+	return Response[T]{
+		Page:          p.Number,
+		PageSize:      p.Size,
+		TotalElements: total,
+		TotalPages:    TotalPages(total, p.Size),
+		Items:         items,
+	}
+}
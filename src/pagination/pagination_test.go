@@ -0,0 +1,54 @@
+package pagination
+
+import "testing"
+
+var columns = Columns{
+	"name":   "books.name",
+	"author": "books.author",
+}
+
+func TestParse(t *testing.T) {
+	p, err := Parse("", "", "", columns, "name")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if p.Number != 1 || p.Size != DefaultSize || p.Sort != "name" || p.Desc {
+		t.Errorf("unexpected defaults %+v", p)
+	}
+
+	p, err = Parse("3", "20", "author,desc", columns, "name")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if p.Offset() != 40 {
+		t.Errorf("expected offset 40, got %d", p.Offset())
+	}
+	if got := p.OrderBy(columns, "books.id"); got != "ORDER BY books.author DESC, books.id" {
+		t.Errorf("unexpected order by %q", got)
+	}
+
+	invalid := [][3]string{
+		{"0", "", ""},
+		{"x", "", ""},
+		{"", "0", ""},
+		{"", "101", ""},
+		{"", "", "books.name; DROP TABLE books"},
+		{"", "", "name,sideways"},
+	}
+	for _, params := range invalid {
+		if _, err := Parse(params[0], params[1], params[2], columns, "name"); err == nil {
+			t.Errorf("expected error for %q", params)
+		}
+	}
+}
+
+func TestNewResponse(t *testing.T) {
+	res := NewResponse[string](Page{Number: 2, Size: 10}, 21, nil)
+	if res.TotalPages != 3 || res.TotalElements != 21 || res.Items == nil {
+		t.Errorf("unexpected response %+v", res)
+	}
+
+	if TotalPages(0, 10) != 0 || TotalPages(20, 10) != 2 {
+		t.Errorf("unexpected total pages")
+	}
+}
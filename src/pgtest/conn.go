@@ -0,0 +1,76 @@
+package pgtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// HostEnv names the variable pointing Open at a Postgres with the schema of
+// postgres/10-create-user.sql, e.g. the one docker compose starts.
+const HostEnv = "PGTEST_HOST"
+
+// Conn runs a storage layer against a real database inside one transaction
+// that is rolled back when the test ends. Transactions the storage begins
+// become savepoints, so nothing a test writes is committed, not even the
+// outbox rows a running relay would publish.
+type Conn struct {
+	tx pgx.Tx
+}
+
+// Open connects to dbname as the services do, skipping the test when HostEnv
+// is not set.
+func Open(t *testing.T, dbname string) *Conn {
+	t.Helper()
+
+	host := os.Getenv(HostEnv)
+	if host == "" {
+		t.Skipf("%s is not set", HostEnv)
+	}
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, fmt.Sprintf("host=%s port=%d user=%s dbname=%s password=%s",
+		host, 5432, "program", dbname, "test"))
+	if err != nil {
+		t.Fatalf("unable to connect to %s: %v", dbname, err)
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		conn.Close(ctx)
+		t.Fatalf("unable to begin transaction: %v", err)
+	}
+
+	t.Cleanup(func() {
+		tx.Rollback(ctx)
+		conn.Close(ctx)
+	})
+
+	return &Conn{tx: tx}
+}
+
+func (c *Conn) Begin(ctx context.Context) (pgx.Tx, error) {
+	return c.tx.Begin(ctx)
+}
+
+func (c *Conn) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return c.tx.Exec(ctx, sql, args...)
+}
+
+func (c *Conn) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return c.tx.Query(ctx, sql, args...)
+}
+
+func (c *Conn) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return c.tx.QueryRow(ctx, sql, args...)
+}
+
+func (c *Conn) Ping(ctx context.Context) error {
+	return c.tx.Conn().Ping(ctx)
+}
+
+func (c *Conn) Close() {}
@@ -0,0 +1,133 @@
+// Package pgtest provides stand-ins for pgxpool.Pool in storage tests. A
+// Recorder records the statements a storage layer sends instead of running
+// them, to check that user input travels as bound arguments and never as SQL.
+// A Conn runs them against a real database, see Open.
+package pgtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrRecorded is returned by every recorded statement.
+var ErrRecorded = errors.New("statement recorded, not executed")
+
+type Statement struct {
+	SQL  string
+	Args []any
+}
+
+type Recorder struct {
+	Statements []Statement
+}
+
+func (r *Recorder) record(sql string, args []any) {
+	r.Statements = append(r.Statements, Statement{SQL: sql, Args: args})
+}
+
+func (r *Recorder) Begin(_ context.Context) (pgx.Tx, error) {
+	return &tx{recorder: r}, nil
+}
+
+func (r *Recorder) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	r.record(sql, args)
+	return pgconn.CommandTag{}, ErrRecorded
+}
+
+func (r *Recorder) Query(_ context.Context, sql string, args ...any) (pgx.Rows, error) {
+	r.record(sql, args)
+	return nil, ErrRecorded
+}
+
+func (r *Recorder) QueryRow(_ context.Context, sql string, args ...any) pgx.Row {
+	r.record(sql, args)
+	return row{}
+}
+
+func (r *Recorder) Ping(_ context.Context) error {
+	return nil
+}
+
+func (r *Recorder) Close() {}
+
+// AssertBound fails t unless at least one statement was recorded, input
+// appears in no statement text and is passed as an argument.
+func (r *Recorder) AssertBound(t *testing.T, input string) {
+	t.Helper()
+
+	if len(r.Statements) == 0 {
+		t.Fatal("no statements recorded")
+	}
+
+	bound := false
+	for _, statement := range r.Statements {
+		if strings.Contains(statement.SQL, input) {
+			t.Fatalf("input %q was interpolated into %q", input, statement.SQL)
+		}
+		if strings.Contains(strings.ToUpper(statement.SQL), "SELECT *") {
+			t.Fatalf("statement %q selects implicit columns", statement.SQL)
+		}
+		for _, arg := range statement.Args {
+			if named, ok := arg.(pgx.NamedArgs); ok {
+				for _, value := range named {
+					if fmt.Sprint(value) == input {
+						bound = true
+					}
+				}
+			}
+			if values, ok := arg.([]string); ok {
+				for _, value := range values {
+					if value == input {
+						bound = true
+					}
+				}
+			}
+			if fmt.Sprint(arg) == input {
+				bound = true
+			}
+		}
+	}
+
+	if !bound {
+		t.Fatalf("input %q was not passed as an argument", input)
+	}
+}
+
+type row struct{}
+
+func (row) Scan(_ ...any) error {
+	return ErrRecorded
+}
+
+// tx forwards statements to the recorder. Methods the storage layers do not
+// use panic through the nil embedded interface.
+type tx struct {
+	pgx.Tx
+	recorder *Recorder
+}
+
+func (t *tx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return t.recorder.Exec(ctx, sql, args...)
+}
+
+func (t *tx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return t.recorder.Query(ctx, sql, args...)
+}
+
+func (t *tx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return t.recorder.QueryRow(ctx, sql, args...)
+}
+
+func (t *tx) Commit(_ context.Context) error {
+	return nil
+}
+
+func (t *tx) Rollback(_ context.Context) error {
+	return nil
+}
@@ -3,12 +3,12 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"lab2/src/rating-service/storage"
 
-	"github.com/IBM/sarama"
 	"github.com/gin-gonic/gin"
 )
 
@@ -21,8 +21,7 @@ type MessageResponse struct {
 }
 
 type Handler struct {
-	storage  storage.Storage
-	producer sarama.SyncProducer
+	storage storage.Storage
 }
 
 type RatingResponse struct {
@@ -34,8 +33,8 @@ type UpdateRatingRequest struct {
 	Username string `json:"username"`
 }
 
-func NewHandler(storage storage.Storage, producer sarama.SyncProducer) *Handler {
-	return &Handler{storage: storage, producer: producer}
+func NewHandler(storage storage.Storage) *Handler {
+	return &Handler{storage: storage}
 }
 
 func (h *Handler) GetRating(c *gin.Context) {
@@ -88,7 +87,13 @@ func (h *Handler) UpdateRating(c *gin.Context) {
 		username = reqRating.Username
 	}
 
-	err = h.storage.UpdateRating(context.Background(), username, reqRating.Stars)
+	err = h.storage.UpdateRating(context.Background(), username, reqRating.Stars, c.GetHeader("Idempotency-Key"))
+	if errors.Is(err, storage.ErrKeyReused) {
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		fmt.Printf("failed to update raing %s\n", err.Error())
 		c.JSON(http.StatusBadRequest, ErrorResponse{
@@ -97,8 +102,6 @@ func (h *Handler) UpdateRating(c *gin.Context) {
 		return
 	}
 
-	h.sendEvent("Рейтинг обновился")
-
 	c.JSON(http.StatusOK, MessageResponse{
 		Message: "rating updated",
 	})
@@ -107,21 +110,3 @@ func (h *Handler) UpdateRating(c *gin.Context) {
 func (h *Handler) GetHealth(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
-
-func (h *Handler) sendEvent(event string) {
-	if h.producer == nil {
-		return
-	}
-
-	const topic = "events"
-
-	msg := &sarama.ProducerMessage{
-		Topic: topic,
-		Value: sarama.StringEncoder(event),
-	}
-
-	_, _, err := h.producer.SendMessage(msg)
-	if err != nil {
-		fmt.Printf("failed to send kafka event: %s\n", err.Error())
-	}
-}
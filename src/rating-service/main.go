@@ -3,12 +3,16 @@ package main
 import (
 	"context"
 	"fmt"
+	"log"
+	"time"
 
 	"lab2/src/kafka"
 	"lab2/src/middleware"
+	"lab2/src/outbox"
 	"lab2/src/rating-service/handler"
 	"lab2/src/rating-service/storage"
 
+	"github.com/IBM/sarama"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
@@ -24,15 +28,15 @@ func main() {
 	}
 	defer psqlDB.Close()
 
-	producer, err := kafka.NewSyncProducer([]string{"kafka:9092"})
-	if err != nil {
-		fmt.Printf("kafka producer init: %s", err)
-	} else {
-		fmt.Println("Connected to Kafka for rating service")
-	}
-	defer kafka.CloseProducer(producer)
+	relay := outbox.NewRelay(psqlDB.Outbox(), func() (sarama.SyncProducer, error) {
+		return kafka.NewSyncProducer([]string{"kafka:9092"})
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go relay.Run(ctx)
+	go purge(ctx, psqlDB)
 
-	handler := handler.NewHandler(psqlDB, producer)
+	handler := handler.NewHandler(psqlDB)
 
 	router := gin.Default()
 
@@ -53,3 +57,23 @@ func main() {
 
 	router.Run(":8050")
 }
+
+// purge drops idempotency keys of rating updates past their retention.
+func purge(ctx context.Context, st storage.Storage) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purged, err := st.PurgeRatingOperations(ctx, now.UTC().Add(-storage.RatingOperationRetention))
+			if err != nil {
+				log.Printf("failed to purge rating operations: %v", err)
+			} else if purged > 0 {
+				log.Printf("purged %d rating operations", purged)
+			}
+		}
+	}
+}
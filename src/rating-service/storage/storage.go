@@ -5,8 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
+
+	"lab2/src/events"
+	"lab2/src/outbox"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -16,13 +21,31 @@ type Rating struct {
 	Stars    int    `json:"stars"`
 }
 
+var ErrKeyReused = errors.New("idempotency key was used for another rating update")
+
+// RatingOperationRetention is how long idempotency keys of rating updates are
+// kept. It outlives the deadline of the gateway jobs that repeat them.
+const RatingOperationRetention = 7 * 24 * time.Hour
+
 type Storage interface {
 	GetRating(ctx context.Context, username string) (Rating, error)
-	UpdateRating(ctx context.Context, username string, stars int) error
+	UpdateRating(ctx context.Context, username string, stars int, key string) error
+	PurgeRatingOperations(ctx context.Context, before time.Time) (int, error)
+}
+
+// database is implemented by *pgxpool.Pool; tests replace it with a
+// pgtest.Recorder.
+type database interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Ping(ctx context.Context) error
+	Close()
 }
 
 type postgres struct {
-	db *pgxpool.Pool
+	db database
 }
 
 func NewPgStorage(ctx context.Context, connString string) (*postgres, error) {
@@ -50,9 +73,9 @@ func (pg *postgres) Close() {
 }
 
 func (pg *postgres) GetRating(ctx context.Context, username string) (Rating, error) {
-	query := fmt.Sprintf(`SELECT id, username, stars FROM rating WHERE username = '%s'`, username)
+	query := `SELECT id, username, stars FROM rating WHERE username = $1`
 
-	rows, err := pg.db.Query(ctx, query)
+	rows, err := pg.db.Query(ctx, query, username)
 
 	var rating Rating
 
@@ -83,11 +106,45 @@ func (pg *postgres) GetRating(ctx context.Context, username string) (Rating, err
 	return rating, nil
 }
 
-func (pg *postgres) UpdateRating(ctx context.Context, username string, stars int) error {
-	//temporary solution
-	query := fmt.Sprintf(`SELECT id, username, stars FROM rating WHERE username = '%s'`, username)
+// UpdateRating adds stars to the rating of username. A non-empty key makes the
+// update idempotent: repeating it changes nothing, and reusing the key for a
+// different update fails with ErrKeyReused.
+func (pg *postgres) UpdateRating(ctx context.Context, username string, stars int, key string) error {
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if key != "" {
+		query := `INSERT INTO rating_operations (operation_key, username, delta, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (operation_key) DO NOTHING`
 
-	rows, err := pg.db.Query(ctx, query)
+		tag, err := tx.Exec(ctx, query, key, username, stars, time.Now().UTC())
+		if err != nil {
+			return fmt.Errorf("unable to insert row: %w", err)
+		}
+
+		//already applied
+		if tag.RowsAffected() == 0 {
+			var same bool
+			query = `SELECT username = $2 AND delta = $3 FROM rating_operations WHERE operation_key = $1`
+
+			if err = tx.QueryRow(ctx, query, key, username, stars).Scan(&same); err != nil {
+				return fmt.Errorf("unable to query: %w", err)
+			}
+			if !same {
+				return ErrKeyReused
+			}
+
+			return nil
+		}
+	}
+
+	query := `SELECT id, username, stars FROM rating WHERE username = $1 FOR UPDATE`
+
+	rows, err := tx.Query(ctx, query, username)
 
 	var rating Rating
 
@@ -117,12 +174,37 @@ func (pg *postgres) UpdateRating(ctx context.Context, username string, stars int
 	}
 
 	//upd
-	query = fmt.Sprintf(`UPDATE rating SET stars = %d WHERE username = '%s'`, resStars, username)
+	query = `UPDATE rating SET stars = $1 WHERE username = $2`
 
-	_, err = pg.db.Exec(ctx, query)
+	_, err = tx.Exec(ctx, query, resStars, username)
 	if err != nil {
 		return fmt.Errorf("unable to update row: %w", err)
 	}
 
+	event := events.New(events.RatingUpdated, username)
+	event.RatingDelta = resStars - rating.Stars
+	if err = outbox.Add(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
 	return nil
 }
+
+// PurgeRatingOperations forgets idempotency keys recorded before before and
+// returns how many were removed.
+func (pg *postgres) PurgeRatingOperations(ctx context.Context, before time.Time) (int, error) {
+	tag, err := pg.db.Exec(ctx, `DELETE FROM rating_operations WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("unable to delete rows: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+func (pg *postgres) Outbox() outbox.Store {
+	return outbox.NewPgStore(pg.db)
+}
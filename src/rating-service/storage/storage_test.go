@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"lab2/src/pgtest"
+)
+
+const injection = `x' OR '1'='1'; DROP TABLE rating; --`
+
+func TestQueriesBindUserInput(t *testing.T) {
+	cases := map[string]func(pg *postgres) error{
+		"GetRating": func(pg *postgres) error {
+			_, err := pg.GetRating(context.Background(), injection)
+			return err
+		},
+		"UpdateRating": func(pg *postgres) error {
+			return pg.UpdateRating(context.Background(), injection, 1, "")
+		},
+		"UpdateRatingKey": func(pg *postgres) error {
+			return pg.UpdateRating(context.Background(), "user", 1, injection)
+		},
+	}
+
+	for name, call := range cases {
+		t.Run(name, func(t *testing.T) {
+			recorder := &pgtest.Recorder{}
+			if err := call(&postgres{db: recorder}); err == nil {
+				t.Fatal("expected recorded error")
+			}
+			recorder.AssertBound(t, injection)
+		})
+	}
+}
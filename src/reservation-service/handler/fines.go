@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"lab2/src/pagination"
+	"lab2/src/reservation-service/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RequestSettleFines struct {
+	Amount int    `json:"amount"`
+	Note   string `json:"note"`
+}
+
+type FineResponse struct {
+	Entry_uid       string  `json:"entryUid"`
+	Reservation_uid *string `json:"reservationUid,omitempty"`
+	Kind            string  `json:"kind"`
+	Amount          int     `json:"amount"`
+	Note            string  `json:"note,omitempty"`
+	Created_by      string  `json:"createdBy"`
+	Created_at      string  `json:"createdAt"`
+}
+
+type FinesResponse struct {
+	Username  string                            `json:"username"`
+	Balance   int                               `json:"balance"`
+	Threshold int                               `json:"threshold"`
+	Blocked   bool                              `json:"blocked"`
+	Entries   pagination.Response[FineResponse] `json:"entries"`
+}
+
+type DebtorResponse struct {
+	Username string `json:"username"`
+	Balance  int    `json:"balance"`
+}
+
+// GetFines returns the balance and ledger of the current reader.
+func (h *Handler) GetFines(c *gin.Context) {
+	username := c.GetString("username")
+
+	if username == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: "empty username",
+		})
+		return
+	}
+
+	h.fines(c, username)
+}
+
+// GetUserFines returns the balance and ledger of any reader to admins.
+func (h *Handler) GetUserFines(c *gin.Context) {
+	h.fines(c, c.Param("username"))
+}
+
+func (h *Handler) fines(c *gin.Context, username string) {
+	page, err := pagination.Parse(c.Query("page"), c.Query("size"), "", nil, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	balance, err := h.storage.GetFineBalance(context.Background(), username)
+	if err != nil {
+		fmt.Printf("failed to get fine balance %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	entries, total, err := h.storage.GetFines(context.Background(), username, page)
+	if err != nil {
+		fmt.Printf("failed to get fines %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, FinesResponse{
+		Username:  username,
+		Balance:   balance,
+		Threshold: h.tariff.BlockThreshold,
+		Blocked:   balance > h.tariff.BlockThreshold,
+		Entries:   pagination.NewResponse(page, total, FinesToResponse(entries)),
+	})
+}
+
+// PayUserFines records a payment an admin took from a reader at the desk.
+// Readers cannot record payments themselves, there is no payment provider to
+// confirm them.
+func (h *Handler) PayUserFines(c *gin.Context) {
+	h.settle(c, c.Param("username"), storage.FinePayment)
+}
+
+// WaiveUserFines writes off fines of a reader.
+func (h *Handler) WaiveUserFines(c *gin.Context) {
+	h.settle(c, c.Param("username"), storage.FineWaiver)
+}
+
+func (h *Handler) settle(c *gin.Context, username string, kind string) {
+	var reqSettle RequestSettleFines
+
+	err := json.NewDecoder(c.Request.Body).Decode(&reqSettle)
+	if err != nil {
+		fmt.Printf("failed to decode body %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	entry, err := h.storage.SettleFines(context.Background(), c.GetString("username"), username, kind, reqSettle.Amount, reqSettle.Note)
+
+	if errors.Is(err, storage.ErrInvalidAmount) {
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Message: "invalid settlement",
+			Errors:  []ErrorDescription{{Field: "amount", Error: err.Error()}},
+		})
+		return
+	}
+
+	if errors.Is(err, storage.ErrExceedsBalance) {
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("failed to settle fines %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, FineToResponse(entry))
+}
+
+func (h *Handler) GetDebtors(c *gin.Context) {
+	page, err := pagination.Parse(c.Query("page"), c.Query("size"), "", nil, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	debtors, total, err := h.storage.GetDebtors(context.Background(), page)
+	if err != nil {
+		fmt.Printf("failed to get debtors %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	res := make([]DebtorResponse, len(debtors))
+	for index, value := range debtors {
+		res[index] = DebtorResponse{Username: value.Username, Balance: value.Balance}
+	}
+
+	c.JSON(http.StatusOK, pagination.NewResponse(page, total, res))
+}
+
+func FineToResponse(entry storage.FineEntry) FineResponse {
+	return FineResponse{
+		Entry_uid:       entry.Entry_uid,
+		Reservation_uid: entry.Reservation_uid,
+		Kind:            entry.Kind,
+		Amount:          entry.Amount,
+		Note:            entry.Note,
+		Created_by:      entry.Created_by,
+		Created_at:      entry.Created_at.UTC().Format(time.RFC3339),
+	}
+}
+
+func FinesToResponse(entries []storage.FineEntry) []FineResponse {
+	if entries == nil {
+		return nil
+	}
+
+	res := make([]FineResponse, len(entries))
+
+	for index, value := range entries {
+		res[index] = FineToResponse(value)
+	}
+
+	return res
+}
@@ -3,13 +3,14 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"lab2/src/pagination"
 	"lab2/src/reservation-service/storage"
 
-	"github.com/IBM/sarama"
 	"github.com/gin-gonic/gin"
 )
 
@@ -22,19 +23,26 @@ type MessageResponse struct {
 }
 
 type Handler struct {
-	storage  storage.Storage
-	producer sarama.SyncProducer
+	storage       storage.Storage
+	renewalPolicy storage.RenewalPolicy
+	library       Library
+	tariff        storage.Tariff
+	cancelWindow  time.Duration
 }
 
 type RequestCreateReservation struct {
-	BookUid    string `json:"bookUid"`
-	LibraryUid string `json:"libraryUid"`
-	TillDate   string `json:"tillDate"`
+	ReservationUid string `json:"reservationUid"`
+	BookUid        string `json:"bookUid"`
+	LibraryUid     string `json:"libraryUid"`
+	TillDate       string `json:"tillDate"`
 }
 
 type RequestUpdateReservation struct {
 	Condition string `json:"condition"`
-	Date      string `json:"date"`
+}
+
+type RequestSetStatus struct {
+	Status string `json:"status"`
 }
 
 type ReservationResponse struct {
@@ -47,8 +55,8 @@ type ReservationResponse struct {
 	Till_date       string `json:"tillDate"`
 }
 
-func NewHandler(storage storage.Storage, producer sarama.SyncProducer) *Handler {
-	return &Handler{storage: storage, producer: producer}
+func NewHandler(st storage.Storage, library Library, renewalPolicy storage.RenewalPolicy, tariff storage.Tariff, cancelWindow time.Duration) *Handler {
+	return &Handler{storage: st, renewalPolicy: renewalPolicy, library: library, tariff: tariff, cancelWindow: cancelWindow}
 }
 
 func (h *Handler) GetReservations(c *gin.Context) {
@@ -61,7 +69,15 @@ func (h *Handler) GetReservations(c *gin.Context) {
 		return
 	}
 
-	reservations, err := h.storage.GetReservations(context.Background(), username)
+	page, err := pagination.Parse(c.Query("page"), c.Query("size"), c.Query("sort"), storage.SortColumns, "startDate")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	reservations, total, err := h.storage.GetReservations(context.Background(), username, page)
 
 	if err != nil {
 		fmt.Printf("failed to get reservations %s\n", err.Error())
@@ -71,11 +87,41 @@ func (h *Handler) GetReservations(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, ReservationsToResponse(reservations))
+	c.JSON(http.StatusOK, pagination.NewResponse(page, total, ReservationsToResponse(reservations)))
 }
 
 func (h *Handler) GetReservationsAll(c *gin.Context) {
-	reservations, err := h.storage.GetReservationsAll(context.Background())
+	page, err := pagination.Parse(c.Query("page"), c.Query("size"), c.Query("sort"), storage.SortColumns, "startDate")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	reservations, total, err := h.storage.GetReservationsAll(context.Background(), page)
+
+	if err != nil {
+		fmt.Printf("failed to get reservations %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, pagination.NewResponse(page, total, ReservationsToResponse(reservations)))
+}
+
+func (h *Handler) GetOverdueReservations(c *gin.Context) {
+	page, err := pagination.Parse(c.Query("page"), c.Query("size"), c.Query("sort"), storage.SortColumns, "tillDate")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	reservations, total, err := h.storage.GetOverdueReservations(context.Background(), page)
 
 	if err != nil {
 		fmt.Printf("failed to get reservations %s\n", err.Error())
@@ -85,7 +131,7 @@ func (h *Handler) GetReservationsAll(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, ReservationsToResponse(reservations))
+	c.JSON(http.StatusOK, pagination.NewResponse(page, total, ReservationsToResponse(reservations)))
 }
 
 func (h *Handler) GetReservationByUid(c *gin.Context) {
@@ -126,6 +172,31 @@ func (h *Handler) GetRentedReservationAmount(c *gin.Context) {
 	c.JSON(http.StatusOK, reservationAmount)
 }
 
+// GetActiveReservationAmount tells admins and library-service how many copies
+// of a book are out on loan from a library.
+func (h *Handler) GetActiveReservationAmount(c *gin.Context) {
+	libraryUid, bookUid := c.Query("libraryUid"), c.Query("bookUid")
+
+	if libraryUid == "" || bookUid == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: "libraryUid and bookUid are required",
+		})
+		return
+	}
+
+	reservationAmount, err := h.storage.GetActiveReservationAmount(context.Background(), libraryUid, bookUid)
+
+	if err != nil {
+		fmt.Printf("failed to get reservation amount %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, reservationAmount)
+}
+
 func (h *Handler) CreateReservation(c *gin.Context) {
 	username := c.GetString("username")
 
@@ -147,35 +218,72 @@ func (h *Handler) CreateReservation(c *gin.Context) {
 		return
 	}
 
-	reservation, err := h.storage.CreateReservation(context.Background(), username, reqCrRes.BookUid, reqCrRes.LibraryUid, reqCrRes.TillDate)
+	//the initial loan is capped by the same limit as renewals
+	if errs := reqCrRes.validate(time.Now().UTC(), h.renewalPolicy.MaxLoan); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Message: "invalid reservation",
+			Errors:  errs,
+		})
+		return
+	}
 
+	balance, err := h.storage.GetFineBalance(context.Background(), username)
 	if err != nil {
-		fmt.Printf("failed to create reservations %s\n", err.Error())
+		fmt.Printf("failed to get fine balance %s\n", err.Error())
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
 		return
 	}
 
-	h.sendEvent("Книгу забронировали")
+	if balance > h.tariff.BlockThreshold {
+		c.JSON(http.StatusForbidden, ErrorResponse{
+			Message: fmt.Sprintf("unpaid fines of %d exceed %d", balance, h.tariff.BlockThreshold),
+		})
+		return
+	}
 
-	c.JSON(http.StatusOK, ReservationToResponse(reservation))
-}
+	book, held, err := h.library.GetBook(c.Request.Context(), reqCrRes.LibraryUid, reqCrRes.BookUid)
+	if err != nil {
+		fmt.Printf("failed to check library book %s\n", err.Error())
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+			Message: "Library Service unavailable",
+		})
+		return
+	}
 
-func (h *Handler) UpdateReservationStatus(c *gin.Context) {
-	reservation, err := h.storage.GetReservationByUid(context.Background(), c.Param("uid"))
+	if !held {
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Message: "invalid reservation",
+			Errors:  []ErrorDescription{{Field: "bookUid", Error: "is not held by the library"}},
+		})
+		return
+	}
+
+	reservation, err := h.storage.CreateReservation(context.Background(), reqCrRes.ReservationUid, username, reqCrRes.BookUid, reqCrRes.LibraryUid, reqCrRes.TillDate, book.Condition)
+
+	if errors.Is(err, storage.ErrHeldForOther) {
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
 
 	if err != nil {
-		fmt.Printf("failed to get libraries %s\n", err.Error())
+		fmt.Printf("failed to create reservations %s\n", err.Error())
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
 		return
 	}
 
+	c.JSON(http.StatusOK, ReservationToResponse(reservation))
+}
+
+func (h *Handler) UpdateReservationStatus(c *gin.Context) {
 	var reqUpdRes RequestUpdateReservation
 
-	err = json.NewDecoder(c.Request.Body).Decode(&reqUpdRes)
+	err := json.NewDecoder(c.Request.Body).Decode(&reqUpdRes)
 	if err != nil {
 		fmt.Printf("failed to decode body %s\n", err.Error())
 		c.JSON(http.StatusBadRequest, ErrorResponse{
@@ -184,19 +292,39 @@ func (h *Handler) UpdateReservationStatus(c *gin.Context) {
 		return
 	}
 
-	date, err := time.Parse("2006-01-02", reqUpdRes.Date)
+	reservation, err := h.storage.GetReservationByUid(context.Background(), c.Param("uid"))
 	if err != nil {
+		fmt.Printf("failed to get reservation %s\n", err.Error())
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Message: err.Error(),
 		})
 		return
 	}
-	status := "RETURNED"
-	if date.After(reservation.Till_date) {
-		status = "EXPIRED"
+
+	if !mayReturn(reservation, c.GetString("username"), c.GetString("role")) {
+		c.JSON(http.StatusForbidden, ErrorResponse{
+			Message: "reservation belongs to another user",
+		})
+		return
 	}
 
-	err = h.storage.UpdateReservationStatus(context.Background(), c.Param("uid"), status)
+	if reqUpdRes.Condition != "" && !storage.ValidCondition(reqUpdRes.Condition) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: "condition must be one of EXCELLENT, GOOD, BAD",
+		})
+		return
+	}
+
+	//fines are assessed on the server date, whatever the client claims
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	reservation, _, err = h.storage.ReturnReservation(context.Background(), c.Param("uid"), today, reqUpdRes.Condition, h.tariff)
+
+	if errors.Is(err, storage.ErrIllegalTransition) {
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
 
 	if err != nil {
 		fmt.Printf("failed to update reservation %s\n", err.Error())
@@ -206,22 +334,145 @@ func (h *Handler) UpdateReservationStatus(c *gin.Context) {
 		return
 	}
 
-	if status == "EXPIRED" {
-		h.sendEvent("Книгу вернули с опозданием")
-
+	if reservation.Status == storage.StatusReturnedLate {
 		c.JSON(http.StatusNoContent, MessageResponse{
 			Message: "status updated",
 		})
 		return
 	}
 
-	h.sendEvent("Книгу вернули вовремя")
+	c.JSON(http.StatusOK, MessageResponse{
+		Message: "status updated",
+	})
+}
+
+// mayReturn tells whether the caller may return the book of reservation: the
+// reader who took it, or an admin or service acting for them.
+func mayReturn(reservation storage.Reservation, username string, role string) bool {
+	return reservation.Username == username || role == "admin" || role == "service"
+}
+
+func (h *Handler) ConfirmReservation(c *gin.Context) {
+	reservation, err := h.storage.GetReservationByUid(context.Background(), c.Param("uid"))
+
+	if err != nil {
+		fmt.Printf("failed to get reservation %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if reservation.Username != c.GetString("username") {
+		c.JSON(http.StatusForbidden, ErrorResponse{
+			Message: "reservation belongs to another user",
+		})
+		return
+	}
+
+	//repeated confirmation of the same reservation
+	if reservation.Status == storage.StatusRented {
+		c.JSON(http.StatusOK, ReservationToResponse(reservation))
+		return
+	}
+
+	err = h.storage.UpdateReservationStatus(context.Background(), c.Param("uid"), storage.StatusRented)
+
+	if errors.Is(err, storage.ErrIllegalTransition) {
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("failed to confirm reservation %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	reservation.Status = storage.StatusRented
+	c.JSON(http.StatusOK, ReservationToResponse(reservation))
+}
+
+func (h *Handler) SetReservationStatus(c *gin.Context) {
+	var reqSetStatus RequestSetStatus
+
+	err := json.NewDecoder(c.Request.Body).Decode(&reqSetStatus)
+	if err != nil {
+		fmt.Printf("failed to decode body %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if reqSetStatus.Status == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: "empty status",
+		})
+		return
+	}
+
+	err = h.storage.UpdateReservationStatus(context.Background(), c.Param("uid"), reqSetStatus.Status)
+
+	if errors.Is(err, storage.ErrReservationNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if errors.Is(err, storage.ErrIllegalTransition) {
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("failed to update reservation %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, MessageResponse{
 		Message: "status updated",
 	})
 }
 
+func (h *Handler) CancelReservation(c *gin.Context) {
+	reservation, err := h.storage.CancelReservation(context.Background(), c.GetString("username"), c.Param("uid"), h.cancelWindow, time.Now().UTC())
+
+	if errors.Is(err, storage.ErrReservationNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if errors.Is(err, storage.ErrCancelWindow) || errors.Is(err, storage.ErrIllegalTransition) {
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Message: "reservation cannot be cancelled: " + err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("failed to cancel reservation %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ReservationToResponse(reservation))
+}
+
 func ReservationToResponse(reservation storage.Reservation) ReservationResponse {
 	return ReservationResponse{
 		Reservation_uid: reservation.Reservation_uid,
@@ -251,21 +502,3 @@ func ReservationsToResponse(reservations []storage.Reservation) []ReservationRes
 func (h *Handler) GetHealth(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
-
-func (h *Handler) sendEvent(event string) {
-	if h.producer == nil {
-		return
-	}
-
-	const topic = "events"
-
-	msg := &sarama.ProducerMessage{
-		Topic: topic,
-		Value: sarama.StringEncoder(event),
-	}
-
-	_, _, err := h.producer.SendMessage(msg)
-	if err != nil {
-		fmt.Printf("failed to send kafka event: %s\n", err.Error())
-	}
-}
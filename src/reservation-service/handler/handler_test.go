@@ -2,6 +2,9 @@ package handler
 
 import (
 	"testing"
+	"time"
+
+	"lab2/src/reservation-service/storage"
 )
 
 func TestGetReservations(t *testing.T) {
@@ -37,3 +40,69 @@ func TestUpdateReservationStatus(t *testing.T) {
 		t.Errorf("Unexpected situation")
 	}
 }
+
+func TestPlaceHoldValidation(t *testing.T) {
+	valid := RequestPlaceHold{
+		BookUid:    "f7cdc58f-2caf-4b15-9727-f89dcc629b27",
+		LibraryUid: "83575e12-7ce0-48ee-9931-51919ff3c9ee",
+	}
+	if err := valid.validate(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if err := (RequestPlaceHold{BookUid: valid.BookUid}).validate(); err == nil {
+		t.Errorf("expected error for missing libraryUid")
+	}
+	if err := (RequestPlaceHold{BookUid: "book", LibraryUid: valid.LibraryUid}).validate(); err == nil {
+		t.Errorf("expected error for invalid bookUid")
+	}
+}
+
+func TestCreateReservationValidation(t *testing.T) {
+	now := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	maxLoan := 60 * 24 * time.Hour
+
+	valid := RequestCreateReservation{
+		BookUid:    "f7cdc58f-2caf-4b15-9727-f89dcc629b27",
+		LibraryUid: "83575e12-7ce0-48ee-9931-51919ff3c9ee",
+		TillDate:   "2024-03-11",
+	}
+	if errs := valid.validate(now, maxLoan); len(errs) != 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	cases := map[string]struct {
+		req   RequestCreateReservation
+		field string
+	}{
+		"reservation uid": {RequestCreateReservation{ReservationUid: "x", BookUid: valid.BookUid, LibraryUid: valid.LibraryUid, TillDate: valid.TillDate}, "reservationUid"},
+		"book uid":        {RequestCreateReservation{BookUid: "book", LibraryUid: valid.LibraryUid, TillDate: valid.TillDate}, "bookUid"},
+		"library uid":     {RequestCreateReservation{BookUid: valid.BookUid, TillDate: valid.TillDate}, "libraryUid"},
+		"missing date":    {RequestCreateReservation{BookUid: valid.BookUid, LibraryUid: valid.LibraryUid}, "tillDate"},
+		"date format":     {RequestCreateReservation{BookUid: valid.BookUid, LibraryUid: valid.LibraryUid, TillDate: "11.03.2024"}, "tillDate"},
+		"today":           {RequestCreateReservation{BookUid: valid.BookUid, LibraryUid: valid.LibraryUid, TillDate: "2024-03-10"}, "tillDate"},
+		"past date":       {RequestCreateReservation{BookUid: valid.BookUid, LibraryUid: valid.LibraryUid, TillDate: "2021-10-11"}, "tillDate"},
+		"too long":        {RequestCreateReservation{BookUid: valid.BookUid, LibraryUid: valid.LibraryUid, TillDate: "2024-05-10"}, "tillDate"},
+	}
+
+	for name, tc := range cases {
+		errs := tc.req.validate(now, maxLoan)
+		if len(errs) != 1 || errs[0].Field != tc.field {
+			t.Errorf("%s: expected one %s error, got %v", name, tc.field, errs)
+		}
+	}
+}
+
+func TestMayReturn(t *testing.T) {
+	reservation := storage.Reservation{Username: "reader"}
+
+	if !mayReturn(reservation, "reader", "reader") {
+		t.Errorf("owner may not return the book")
+	}
+	if mayReturn(reservation, "other", "reader") {
+		t.Errorf("another reader may return the book")
+	}
+	if !mayReturn(reservation, "other", "admin") || !mayReturn(reservation, "gateway", "service") {
+		t.Errorf("admin or service may not return the book")
+	}
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"lab2/src/reservation-service/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type RequestPlaceHold struct {
+	BookUid    string `json:"bookUid"`
+	LibraryUid string `json:"libraryUid"`
+}
+
+func (r RequestPlaceHold) validate() error {
+	if _, err := uuid.Parse(r.BookUid); err != nil {
+		return errors.New("bookUid must be a uuid")
+	}
+	if _, err := uuid.Parse(r.LibraryUid); err != nil {
+		return errors.New("libraryUid must be a uuid")
+	}
+	return nil
+}
+
+type HoldResponse struct {
+	Hold_uid    string  `json:"holdUid"`
+	Book_uid    string  `json:"bookUid"`
+	Library_uid string  `json:"libraryUid"`
+	Status      string  `json:"status"`
+	Position    int     `json:"position,omitempty"`
+	Created_at  string  `json:"createdAt"`
+	Expires_at  *string `json:"expiresAt,omitempty"`
+}
+
+func (h *Handler) PlaceHold(c *gin.Context) {
+	username := c.GetString("username")
+
+	if username == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: "empty username",
+		})
+		return
+	}
+
+	var reqHold RequestPlaceHold
+
+	err := json.NewDecoder(c.Request.Body).Decode(&reqHold)
+	if err != nil {
+		fmt.Printf("failed to decode body %s\n", err.Error())
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := reqHold.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	book, held, err := h.library.GetBook(c.Request.Context(), reqHold.LibraryUid, reqHold.BookUid)
+	if err != nil {
+		fmt.Printf("failed to check library book %s\n", err.Error())
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+			Message: "Library Service unavailable",
+		})
+		return
+	}
+
+	if !held {
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse{
+			Message: "invalid hold",
+			Errors:  []ErrorDescription{{Field: "bookUid", Error: "is not held by the library"}},
+		})
+		return
+	}
+
+	hold, err := h.storage.PlaceHold(context.Background(), username, reqHold.LibraryUid, reqHold.BookUid, book.Available_count)
+	h.holdResponse(c, http.StatusCreated, hold, err)
+}
+
+func (h *Handler) GetHolds(c *gin.Context) {
+	username := c.GetString("username")
+
+	if username == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: "empty username",
+		})
+		return
+	}
+
+	holds, err := h.storage.GetHolds(context.Background(), username)
+	if err != nil {
+		fmt.Printf("failed to get holds %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, HoldsToResponse(holds))
+}
+
+func (h *Handler) CancelHold(c *gin.Context) {
+	hold, err := h.storage.CancelHold(context.Background(), c.GetString("username"), c.Param("uid"))
+	h.holdResponse(c, http.StatusOK, hold, err)
+}
+
+func (h *Handler) holdResponse(c *gin.Context, status int, hold storage.Hold, err error) {
+	switch {
+	case errors.Is(err, storage.ErrHoldNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Message: err.Error(),
+		})
+	case errors.Is(err, storage.ErrHoldExists), errors.Is(err, storage.ErrHoldInactive), errors.Is(err, storage.ErrCopiesFree):
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Message: err.Error(),
+		})
+	case err != nil:
+		fmt.Printf("failed to update hold %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Message: err.Error(),
+		})
+	default:
+		c.JSON(status, HoldToResponse(hold))
+	}
+}
+
+func HoldToResponse(hold storage.Hold) HoldResponse {
+	res := HoldResponse{
+		Hold_uid:    hold.Hold_uid,
+		Book_uid:    hold.Book_uid,
+		Library_uid: hold.Library_uid,
+		Status:      hold.Status,
+		Position:    hold.Position,
+		Created_at:  hold.Created_at.UTC().Format(time.RFC3339),
+	}
+
+	if hold.Expires_at != nil {
+		expiresAt := hold.Expires_at.UTC().Format(time.RFC3339)
+		res.Expires_at = &expiresAt
+	}
+
+	return res
+}
+
+func HoldsToResponse(holds []storage.Hold) []HoldResponse {
+	res := make([]HoldResponse, len(holds))
+
+	for index, value := range holds {
+		res[index] = HoldToResponse(value)
+	}
+
+	return res
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"lab2/src/events"
+
+	"github.com/IBM/sarama"
+)
+
+// HoldPromoter passes copies a library adds to a book to the readers waiting
+// for it. Redelivered events are skipped by the storage, so a message is
+// only marked once its copies were handed out.
+type HoldPromoter struct {
+	h *Handler
+}
+
+func (h *Handler) HoldPromoter() *HoldPromoter {
+	return &HoldPromoter{h: h}
+}
+
+func (p *HoldPromoter) Setup(_ sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (p *HoldPromoter) Cleanup(_ sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (p *HoldPromoter) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for message := range claim.Messages() {
+		event, err := events.Decode(message.Value)
+		if err != nil {
+			log.Printf("skipping kafka message at offset %d: %v", message.Offset, err)
+		} else if err = p.h.promote(session.Context(), event); err != nil {
+			//not marked, the session restarts from this message
+			return err
+		}
+		session.MarkMessage(message, "")
+	}
+	return nil
+}
+
+func (h *Handler) promote(ctx context.Context, event events.Event) error {
+	if event.Type != events.HoldingUpdated || event.Copies <= 0 {
+		return nil
+	}
+
+	promoted, err := h.storage.PromoteHolds(ctx, event.ID, event.LibraryUid, event.BookUid, event.Copies, time.Now().UTC())
+	if err != nil {
+		log.Printf("failed to promote holds on %s/%s: %v", event.LibraryUid, event.BookUid, err)
+		return err
+	}
+	if promoted > 0 {
+		log.Printf("promoted %d holds on %s/%s", promoted, event.LibraryUid, event.BookUid)
+	}
+	return nil
+}
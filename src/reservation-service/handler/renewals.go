@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"lab2/src/reservation-service/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RenewalResponse struct {
+	Reservation_uid string `json:"reservationUid"`
+	Till_date       string `json:"tillDate"`
+	Renewals        int    `json:"renewals"`
+	Renewals_left   int    `json:"renewalsLeft"`
+}
+
+func (h *Handler) RenewReservation(c *gin.Context) {
+	renewal, err := h.storage.RenewReservation(context.Background(), c.GetString("username"), c.Param("uid"), h.renewalPolicy)
+
+	switch {
+	case errors.Is(err, storage.ErrReservationNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Message: err.Error(),
+		})
+	case errors.Is(err, storage.ErrNotRenewable), errors.Is(err, storage.ErrRenewalLimit),
+		errors.Is(err, storage.ErrLoanLimit), errors.Is(err, storage.ErrHoldsPending):
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Message: err.Error(),
+		})
+	case err != nil:
+		fmt.Printf("failed to renew reservation %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Message: err.Error(),
+		})
+	default:
+		c.JSON(http.StatusOK, RenewalResponse{
+			Reservation_uid: renewal.Reservation.Reservation_uid,
+			Till_date:       renewal.Reservation.Till_date.Format("2006-01-02"),
+			Renewals:        renewal.Renewals,
+			Renewals_left:   h.renewalPolicy.MaxRenewals - renewal.Renewals,
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ErrorDescription struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+type ValidationErrorResponse struct {
+	Message string             `json:"message"`
+	Errors  []ErrorDescription `json:"errors"`
+}
+
+// validate checks the fields of a new reservation. tillDate has to be after
+// the day of now and at most maxLoan later.
+func (r RequestCreateReservation) validate(now time.Time, maxLoan time.Duration) []ErrorDescription {
+	var errs []ErrorDescription
+
+	if r.ReservationUid != "" {
+		if _, err := uuid.Parse(r.ReservationUid); err != nil {
+			errs = append(errs, ErrorDescription{Field: "reservationUid", Error: "must be a uuid"})
+		}
+	}
+	if _, err := uuid.Parse(r.BookUid); err != nil {
+		errs = append(errs, ErrorDescription{Field: "bookUid", Error: "must be a uuid"})
+	}
+	if _, err := uuid.Parse(r.LibraryUid); err != nil {
+		errs = append(errs, ErrorDescription{Field: "libraryUid", Error: "must be a uuid"})
+	}
+
+	today := now.UTC().Truncate(24 * time.Hour)
+	tillDate, err := time.Parse("2006-01-02", r.TillDate)
+	switch {
+	case r.TillDate == "":
+		errs = append(errs, ErrorDescription{Field: "tillDate", Error: "is required"})
+	case err != nil:
+		errs = append(errs, ErrorDescription{Field: "tillDate", Error: "must be a date in YYYY-MM-DD format"})
+	case !tillDate.After(today):
+		errs = append(errs, ErrorDescription{Field: "tillDate", Error: "must be after today"})
+	case tillDate.After(today.Add(maxLoan)):
+		errs = append(errs, ErrorDescription{Field: "tillDate", Error: fmt.Sprintf("must be within %d days", int(maxLoan.Hours()/24))})
+	}
+
+	return errs
+}
+
+type LibraryBook struct {
+	Condition       string `json:"condition"`
+	Available_count int    `json:"availableCount"`
+}
+
+// Library looks up a book in a library; found is false when the library does
+// not hold it.
+type Library interface {
+	GetBook(ctx context.Context, libraryUid string, bookUid string) (book LibraryBook, found bool, err error)
+}
+
+type libraryClient struct {
+	url    string
+	client *http.Client
+}
+
+func NewLibraryClient(url string) Library {
+	return &libraryClient{url: url, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (l *libraryClient) GetBook(ctx context.Context, libraryUid string, bookUid string) (LibraryBook, bool, error) {
+	requestURL := fmt.Sprintf("%s/api/v1/libraries/%s/books/%s", l.url, libraryUid, bookUid)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return LibraryBook{}, false, err
+	}
+
+	res, err := l.client.Do(req)
+	if err != nil {
+		return LibraryBook{}, false, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		var book LibraryBook
+		if err = json.NewDecoder(res.Body).Decode(&book); err != nil {
+			return LibraryBook{}, false, err
+		}
+		return book, true, nil
+	case http.StatusNotFound:
+		return LibraryBook{}, false, nil
+	default:
+		return LibraryBook{}, false, fmt.Errorf("GET %s: %d", requestURL, res.StatusCode)
+	}
+}
@@ -3,12 +3,19 @@ package main
 import (
 	"context"
 	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
 
+	"lab2/src/events"
 	"lab2/src/kafka"
 	"lab2/src/middleware"
+	"lab2/src/outbox"
 	"lab2/src/reservation-service/handler"
 	"lab2/src/reservation-service/storage"
 
+	"github.com/IBM/sarama"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
@@ -24,15 +31,57 @@ func main() {
 	}
 	defer psqlDB.Close()
 
-	producer, err := kafka.NewSyncProducer([]string{"kafka:9092"})
-	if err != nil {
-		fmt.Printf("kafka producer init: %s", err)
-	} else {
-		fmt.Println("Connected to Kafka for reservation service")
+	relay := outbox.NewRelay(psqlDB.Outbox(), func() (sarama.SyncProducer, error) {
+		return kafka.NewSyncProducer([]string{"kafka:9092"})
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go relay.Run(ctx)
+	go sweep(ctx, psqlDB)
+
+	//MaxLoan also bounds the till date of new reservations
+	renewalPolicy := storage.RenewalPolicy{
+		MaxRenewals: envInt("RENEWAL_MAX_COUNT", storage.DefaultRenewalPolicy.MaxRenewals),
+		Period:      envPeriod("RENEWAL_PERIOD_DAYS", day, storage.DefaultRenewalPolicy.Period),
+		MaxLoan:     envPeriod("LOAN_MAX_DAYS", day, storage.DefaultRenewalPolicy.MaxLoan),
+	}
+
+	tariff := storage.Tariff{
+		PerDayOverdue:     envInt("FINE_PER_DAY_OVERDUE", storage.DefaultTariff.PerDayOverdue),
+		PerConditionLevel: envInt("FINE_PER_CONDITION_LEVEL", storage.DefaultTariff.PerConditionLevel),
+		BlockThreshold:    envInt("FINE_BLOCK_THRESHOLD", storage.DefaultTariff.BlockThreshold),
 	}
-	defer kafka.CloseProducer(producer)
 
-	handler := handler.NewHandler(psqlDB, producer)
+	cancelWindow := envPeriod("CANCEL_WINDOW_HOURS", time.Hour, storage.DefaultCancelWindow)
+
+	handler := handler.NewHandler(psqlDB, handler.NewLibraryClient("http://library-service:8060"), renewalPolicy, tariff, cancelWindow)
+
+	//copies added by a library go to the readers waiting for them
+	go func() {
+		consumerGroup, err := kafka.NewConsumerGroup([]string{"kafka:9092"}, "reservation-holds", sarama.OffsetNewest)
+		if err != nil {
+			log.Printf("hold promotion on added copies disabled: %s", err)
+			return
+		}
+		defer consumerGroup.Close()
+
+		go func() {
+			for err := range consumerGroup.Errors() {
+				log.Printf("consumer group error: %v", err)
+			}
+		}()
+
+		for {
+			if err := consumerGroup.Consume(ctx, []string{events.Topic}, handler.HoldPromoter()); err != nil {
+				log.Printf("error consuming kafka topic: %v", err)
+				time.Sleep(time.Second)
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}()
 
 	router := gin.Default()
 
@@ -47,13 +96,98 @@ func main() {
 	jwtMiddleware := middleware.NewJWTMiddleware("http://idp-service:8090")
 
 	router.GET("/api/v1/reservations", jwtMiddleware.Middleware(), handler.GetReservations)
-	router.GET("/api/v1/reservations/all", jwtMiddleware.Middleware(), handler.GetReservationsAll)
+	router.GET("/api/v1/reservations/all", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.GetReservationsAll)
+	router.GET("/api/v1/reservations/overdue", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.GetOverdueReservations)
 	router.GET("/api/v1/reservations/info/:uid", jwtMiddleware.Middleware(), handler.GetReservationByUid)
 	router.GET("/api/v1/reservations/amount", jwtMiddleware.Middleware(), handler.GetRentedReservationAmount)
+	router.GET("/api/v1/reservations/active", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.GetActiveReservationAmount)
 	router.POST("/api/v1/reservations", jwtMiddleware.Middleware(), handler.CreateReservation)
 	router.PUT("/api/v1/reservations/:uid", jwtMiddleware.Middleware(), handler.UpdateReservationStatus)
+	router.POST("/api/v1/reservations/:uid/confirm", jwtMiddleware.Middleware(), handler.ConfirmReservation)
+	router.PUT("/api/v1/reservations/:uid/status", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.SetReservationStatus)
+	router.POST("/api/v1/reservations/:uid/cancel", jwtMiddleware.Middleware(), handler.CancelReservation)
+	router.POST("/api/v1/reservations/:uid/renew", jwtMiddleware.Middleware(), handler.RenewReservation)
+
+	router.GET("/api/v1/holds", jwtMiddleware.Middleware(), handler.GetHolds)
+	router.POST("/api/v1/holds", jwtMiddleware.Middleware(), handler.PlaceHold)
+	router.DELETE("/api/v1/holds/:uid", jwtMiddleware.Middleware(), handler.CancelHold)
+
+	router.GET("/api/v1/fines", jwtMiddleware.Middleware(), handler.GetFines)
+	router.GET("/api/v1/fines/debtors", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.GetDebtors)
+	router.GET("/api/v1/fines/users/:username", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.GetUserFines)
+	router.POST("/api/v1/fines/users/:username/payments", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.PayUserFines)
+	router.POST("/api/v1/fines/users/:username/waivers", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.WaiveUserFines)
 
 	router.GET("/manage/health", handler.GetHealth)
 
 	router.Run(":8070")
 }
+
+// sweep marks loans past their till date as overdue and passes held copies
+// not picked up in time to the next reader.
+func sweep(ctx context.Context, st storage.Storage) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			sweepOnce(ctx, st, now.UTC())
+		}
+	}
+}
+
+// sweepOnce runs both sweeps; one failing does not hold back the other.
+func sweepOnce(ctx context.Context, st storage.Storage, now time.Time) {
+	overdue, err := st.MarkOverdue(ctx, now)
+	if err != nil {
+		log.Printf("failed to mark overdue reservations: %v", err)
+	} else if overdue > 0 {
+		log.Printf("marked %d reservations overdue", overdue)
+	}
+
+	expired, err := st.ExpireHolds(ctx, now)
+	if err != nil {
+		log.Printf("failed to expire holds: %v", err)
+	} else if expired > 0 {
+		log.Printf("expired %d holds", expired)
+	}
+}
+
+// envInt reads a non-negative integer setting, falling back to def when the
+// variable is unset or invalid.
+func envInt(name string, def int) int {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("invalid %s %q, using %d", name, value, def)
+		return def
+	}
+
+	return n
+}
+
+const day = 24 * time.Hour
+
+// envPeriod reads a positive number of units, falling back to def when the
+// variable is unset or invalid.
+func envPeriod(name string, unit time.Duration, def time.Duration) time.Duration {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Printf("invalid %s %q, using %s", name, value, def)
+		return def
+	}
+
+	return time.Duration(n) * unit
+}
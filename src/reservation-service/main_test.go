@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"lab2/src/reservation-service/storage"
+)
+
+// sweptStorage records the sweeps; other Storage methods are not used.
+type sweptStorage struct {
+	storage.Storage
+	overdueErr error
+	overdueAt  []time.Time
+	expiredAt  []time.Time
+}
+
+func (s *sweptStorage) MarkOverdue(_ context.Context, now time.Time) (int, error) {
+	s.overdueAt = append(s.overdueAt, now)
+	return 0, s.overdueErr
+}
+
+func (s *sweptStorage) ExpireHolds(_ context.Context, now time.Time) (int, error) {
+	s.expiredAt = append(s.expiredAt, now)
+	return 1, nil
+}
+
+func TestSweepOnce(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	st := &sweptStorage{overdueErr: errors.New("connection refused")}
+
+	sweepOnce(context.Background(), st, now)
+
+	if len(st.overdueAt) != 1 || !st.overdueAt[0].Equal(now) {
+		t.Fatalf("expected overdue loans marked as of %s, got %v", now, st.overdueAt)
+	}
+	if len(st.expiredAt) != 1 || !st.expiredAt[0].Equal(now) {
+		t.Fatalf("expected holds expired despite the failed overdue sweep, got %v", st.expiredAt)
+	}
+}
+
+func TestSweepStops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		sweep(ctx, &sweptStorage{})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected sweep to stop with its context")
+	}
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultCancelWindow is how long after taking a book a reader can still
+// cancel the reservation instead of returning the book.
+//
+// A reservation is RENTED as soon as the gateway saga took its copy, there is
+// no separate pickup step, so a reader changing their mind finds it RENTED
+// already. Cancelling within the window gives the copy back without the
+// reservation counting as a loan; PENDING reservations are left to the saga
+// that owns them.
+const DefaultCancelWindow = 24 * time.Hour
+
+var ErrCancelWindow = errors.New("cancellation window has passed")
+
+// CancelReservation cancels a reservation of username. Pending reservations
+// are always cancelled, rented ones only within window of their start, and
+// their copy passes to the next hold. A reservation that is already
+// cancelled is returned as is.
+func (pg *postgres) CancelReservation(ctx context.Context, username string, reservationUid string, window time.Duration, now time.Time) (Reservation, error) {
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return Reservation{}, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	reservation, err := lockReservation(ctx, tx, reservationUid)
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	if reservation.Username != username {
+		return Reservation{}, ErrReservationNotFound
+	}
+	if reservation.Status == StatusCancelled {
+		return reservation, nil
+	}
+	if reservation.Status == StatusRented && now.After(reservation.Start_date.Add(window)) {
+		return Reservation{}, ErrCancelWindow
+	}
+
+	reservation, err = transition(ctx, tx, reservationUid, StatusCancelled)
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return Reservation{}, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
+	return reservation, nil
+}
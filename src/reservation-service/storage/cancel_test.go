@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"lab2/src/pgtest"
+)
+
+func TestCancelWindow(t *testing.T) {
+	pg := &postgres{db: pgtest.Open(t, "reservations")}
+	ctx := context.Background()
+	libraryUid, bookUid := pair()
+
+	reservation := loan(t, pg, libraryUid, bookUid, time.Now().AddDate(0, 0, 14))
+
+	late := reservation.Start_date.Add(DefaultCancelWindow + time.Minute)
+	_, err := pg.CancelReservation(ctx, reservation.Username, reservation.Reservation_uid, DefaultCancelWindow, late)
+	if !errors.Is(err, ErrCancelWindow) {
+		t.Fatalf("expected ErrCancelWindow, got %v", err)
+	}
+
+	waiting := placeHold(t, pg, libraryUid, bookUid)
+
+	cancelled, err := pg.CancelReservation(ctx, reservation.Username, reservation.Reservation_uid, DefaultCancelWindow, reservation.Start_date.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Status != StatusCancelled {
+		t.Fatalf("expected the reservation cancelled, got %s", cancelled.Status)
+	}
+	if hold := holdOf(t, pg, waiting); hold.Status != HoldReady {
+		t.Fatalf("expected the copy given back to go to the waiting hold, got %s", hold.Status)
+	}
+
+	again, err := pg.CancelReservation(ctx, reservation.Username, reservation.Reservation_uid, DefaultCancelWindow, late)
+	if err != nil || again.Status != StatusCancelled {
+		t.Fatalf("expected a repeated cancel to return the cancelled reservation, got %s, %v", again.Status, err)
+	}
+}
+
+func TestCancelOtherReadersReservation(t *testing.T) {
+	pg := &postgres{db: pgtest.Open(t, "reservations")}
+	libraryUid, bookUid := pair()
+
+	reservation := loan(t, pg, libraryUid, bookUid, time.Now().AddDate(0, 0, 14))
+
+	_, err := pg.CancelReservation(context.Background(), reader(), reservation.Reservation_uid, DefaultCancelWindow, reservation.Start_date)
+	if !errors.Is(err, ErrReservationNotFound) {
+		t.Fatalf("expected ErrReservationNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,291 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"lab2/src/events"
+	"lab2/src/outbox"
+	"lab2/src/pagination"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Tariff prices late and damaged returns in whole rubles. Readers whose
+// unpaid fines exceed BlockThreshold cannot take new books.
+type Tariff struct {
+	PerDayOverdue     int
+	PerConditionLevel int
+	BlockThreshold    int
+}
+
+var DefaultTariff = Tariff{
+	PerDayOverdue:     10,
+	PerConditionLevel: 150,
+	BlockThreshold:    300,
+}
+
+// Ledger entry kinds. Fines have a positive amount, payments and waivers a
+// negative one, so the balance of a reader is the sum of their entries.
+const (
+	FineOverdue = "OVERDUE"
+	FineDamage  = "DAMAGE"
+	FinePayment = "PAYMENT"
+	FineWaiver  = "WAIVER"
+)
+
+var (
+	ErrInvalidAmount  = errors.New("amount must be positive")
+	ErrExceedsBalance = errors.New("amount exceeds unpaid fines")
+)
+
+// conditionRanks orders book conditions from best to worst.
+var conditionRanks = map[string]int{
+	"EXCELLENT": 0,
+	"GOOD":      1,
+	"BAD":       2,
+}
+
+func ValidCondition(condition string) bool {
+	_, ok := conditionRanks[condition]
+	return ok
+}
+
+type FineEntry struct {
+	ID              int       `json:"id"`
+	Entry_uid       string    `json:"entry_uid"`
+	Username        string    `json:"username"`
+	Reservation_uid *string   `json:"reservation_uid"`
+	Kind            string    `json:"kind"`
+	Amount          int       `json:"amount"`
+	Note            string    `json:"note"`
+	Created_by      string    `json:"created_by"`
+	Created_at      time.Time `json:"created_at"`
+}
+
+type Debtor struct {
+	Username string `json:"username"`
+	Balance  int    `json:"balance"`
+}
+
+const fineColumns = `id, entry_uid, username, reservation_uid, kind, amount, note, created_by, created_at`
+
+// Assess returns the fines for reservation returned on returned in condition:
+// one per day past till_date and one per condition level lost since checkout.
+// Reservations without a known checkout condition are not fined for damage.
+func (t Tariff) Assess(reservation Reservation, returned time.Time, condition string) []FineEntry {
+	var fines []FineEntry
+
+	days := int(returned.UTC().Truncate(24*time.Hour).Sub(reservation.Till_date.UTC().Truncate(24*time.Hour)).Hours() / 24)
+	if days > 0 && t.PerDayOverdue > 0 {
+		fines = append(fines, FineEntry{
+			Kind:   FineOverdue,
+			Amount: days * t.PerDayOverdue,
+			Note:   fmt.Sprintf("%d days overdue", days),
+		})
+	}
+
+	if reservation.Checkout_condition != nil && ValidCondition(condition) {
+		levels := conditionRanks[condition] - conditionRanks[*reservation.Checkout_condition]
+		if levels > 0 && t.PerConditionLevel > 0 {
+			fines = append(fines, FineEntry{
+				Kind:   FineDamage,
+				Amount: levels * t.PerConditionLevel,
+				Note:   fmt.Sprintf("%s -> %s", *reservation.Checkout_condition, condition),
+			})
+		}
+	}
+
+	return fines
+}
+
+// ReturnReservation marks a reservation returned on returned, late when that
+// is after till_date, and adds the fines of tariff to the reader's ledger in
+// the same transaction.
+func (pg *postgres) ReturnReservation(ctx context.Context, reservationUid string, returned time.Time, condition string, tariff Tariff) (Reservation, []FineEntry, error) {
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return Reservation{}, nil, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	reservation, err := lockReservation(ctx, tx, reservationUid)
+	if err != nil {
+		return Reservation{}, nil, err
+	}
+
+	status := StatusReturned
+	if returned.After(reservation.Till_date) || reservation.Status == StatusOverdue {
+		status = StatusReturnedLate
+	}
+
+	reservation, err = transition(ctx, tx, reservationUid, status)
+	if err != nil {
+		return Reservation{}, nil, err
+	}
+
+	fines := tariff.Assess(reservation, returned, condition)
+	for i := range fines {
+		fines[i].Username = reservation.Username
+		fines[i].Reservation_uid = &reservation.Reservation_uid
+		fines[i].Created_by = reservation.Username
+
+		if fines[i], err = addFineEntry(ctx, tx, fines[i]); err != nil {
+			return Reservation{}, nil, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return Reservation{}, nil, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
+	return reservation, fines, nil
+}
+
+func (pg *postgres) GetFineBalance(ctx context.Context, username string) (int, error) {
+	var balance int
+	err := pg.db.QueryRow(ctx, `SELECT COALESCE(SUM(amount), 0) FROM fine WHERE username = $1`, username).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("unable to query: %w", err)
+	}
+
+	return balance, nil
+}
+
+func (pg *postgres) GetFines(ctx context.Context, username string, page pagination.Page) ([]FineEntry, int, error) {
+	var total int
+	err := pg.db.QueryRow(ctx, `SELECT COUNT(*) FROM fine WHERE username = $1`, username).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to count: %w", err)
+	}
+
+	query := `SELECT ` + fineColumns + ` FROM fine WHERE username = $1
+	ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3`
+
+	rows, err := pg.db.Query(ctx, query, username, page.Size, page.Offset())
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to query: %w", err)
+	}
+	defer rows.Close()
+
+	entries, err := pgx.CollectRows(rows, pgx.RowToStructByName[FineEntry])
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to collect rows: %w", err)
+	}
+
+	return entries, total, nil
+}
+
+// GetDebtors lists readers with unpaid fines, largest balance first.
+func (pg *postgres) GetDebtors(ctx context.Context, page pagination.Page) ([]Debtor, int, error) {
+	var total int
+	query := `SELECT COUNT(*) FROM (SELECT username FROM fine GROUP BY username HAVING SUM(amount) > 0) debtors`
+	if err := pg.db.QueryRow(ctx, query).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("unable to count: %w", err)
+	}
+
+	query = `SELECT username, SUM(amount)::int AS balance FROM fine
+	GROUP BY username HAVING SUM(amount) > 0
+	ORDER BY balance DESC, username LIMIT $1 OFFSET $2`
+
+	rows, err := pg.db.Query(ctx, query, page.Size, page.Offset())
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to query: %w", err)
+	}
+	defer rows.Close()
+
+	debtors, err := pgx.CollectRows(rows, pgx.RowToStructByName[Debtor])
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to collect rows: %w", err)
+	}
+
+	return debtors, total, nil
+}
+
+// SettleFines records a payment or a waiver of amount against the unpaid
+// fines of username. Settling more than is owed is rejected.
+func (pg *postgres) SettleFines(ctx context.Context, actor string, username string, kind string, amount int, note string) (FineEntry, error) {
+	if amount <= 0 {
+		return FineEntry{}, ErrInvalidAmount
+	}
+	if kind != FinePayment && kind != FineWaiver {
+		return FineEntry{}, fmt.Errorf("unknown settlement kind %s", kind)
+	}
+
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return FineEntry{}, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	//settlements of one reader are serialized so the balance cannot go negative
+	if _, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, username); err != nil {
+		return FineEntry{}, fmt.Errorf("unable to lock: %w", err)
+	}
+
+	var balance int
+	err = tx.QueryRow(ctx, `SELECT COALESCE(SUM(amount), 0) FROM fine WHERE username = $1`, username).Scan(&balance)
+	if err != nil {
+		return FineEntry{}, fmt.Errorf("unable to query: %w", err)
+	}
+	if amount > balance {
+		return FineEntry{}, ErrExceedsBalance
+	}
+
+	entry, err := addFineEntry(ctx, tx, FineEntry{
+		Username:   username,
+		Kind:       kind,
+		Amount:     -amount,
+		Note:       note,
+		Created_by: actor,
+	})
+	if err != nil {
+		return FineEntry{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return FineEntry{}, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
+	return entry, nil
+}
+
+// fineEvents maps a ledger entry kind to the event recorded with it.
+var fineEvents = map[string]events.Type{
+	FineOverdue: events.FineAssessed,
+	FineDamage:  events.FineAssessed,
+	FinePayment: events.FinePaid,
+	FineWaiver:  events.FineWaived,
+}
+
+func addFineEntry(ctx context.Context, tx pgx.Tx, entry FineEntry) (FineEntry, error) {
+	entry.Entry_uid = uuid.New().String()
+	entry.Created_at = time.Now().UTC()
+
+	query := `INSERT INTO fine (entry_uid, username, reservation_uid, kind, amount, note, created_by, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+
+	err := tx.QueryRow(ctx, query, entry.Entry_uid, entry.Username, entry.Reservation_uid, entry.Kind,
+		entry.Amount, entry.Note, entry.Created_by, entry.Created_at).Scan(&entry.ID)
+	if err != nil {
+		return FineEntry{}, fmt.Errorf("unable to insert row: %w", err)
+	}
+
+	event := events.New(fineEvents[entry.Kind], entry.Username)
+	if entry.Reservation_uid != nil {
+		event.ReservationUid = *entry.Reservation_uid
+	}
+	event.Amount = entry.Amount
+	if event.Amount < 0 {
+		event.Amount = -event.Amount
+	}
+
+	if err = outbox.Add(ctx, tx, event); err != nil {
+		return FineEntry{}, err
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,339 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"lab2/src/events"
+	"lab2/src/outbox"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// A hold queues a reader for a (library, book) pair without available copies.
+// Holds are served first come, first served: a copy coming back, whether
+// returned, given back by a cancelled loan or added by the library, moves the
+// oldest WAITING hold to READY_FOR_PICKUP, and while it is ready only its
+// holder can reserve the book there. A ready hold that is not picked up
+// within HoldPickupWindow expires and the copy passes to the next hold.
+const (
+	HoldWaiting   = "WAITING"
+	HoldReady     = "READY_FOR_PICKUP"
+	HoldFulfilled = "FULFILLED"
+	HoldExpired   = "EXPIRED"
+	HoldCancelled = "CANCELLED"
+)
+
+const HoldPickupWindow = 48 * time.Hour
+
+var (
+	ErrHoldNotFound = errors.New("hold not found")
+	ErrHoldExists   = errors.New("hold already placed for this book")
+	ErrHoldInactive = errors.New("hold is no longer active")
+	ErrHeldForOther = errors.New("book is held for another reader")
+	ErrCopiesFree   = errors.New("copies of the book are available, reserve it instead")
+)
+
+type Hold struct {
+	ID          int        `json:"id"`
+	Hold_uid    string     `json:"hold_uid"`
+	Username    string     `json:"username"`
+	Book_uid    string     `json:"book_uid"`
+	Library_uid string     `json:"library_uid"`
+	Status      string     `json:"status"`
+	Created_at  time.Time  `json:"created_at"`
+	Ready_at    *time.Time `json:"ready_at"`
+	Expires_at  *time.Time `json:"expires_at"`
+	Position    int        `json:"position"`
+}
+
+// holdColumns include the place in the queue, zero for holds not waiting.
+const holdColumns = `hold.id, hold.hold_uid, hold.username, hold.book_uid, hold.library_uid, hold.status,
+	hold.created_at, hold.ready_at, hold.expires_at,
+	CASE WHEN hold.status = 'WAITING' THEN (SELECT COUNT(*) FROM hold AS ahead
+		WHERE ahead.library_uid = hold.library_uid AND ahead.book_uid = hold.book_uid
+		AND ahead.status = 'WAITING' AND ahead.id <= hold.id) ELSE 0 END AS position`
+
+// PlaceHold queues username for the pair. available is the number of copies
+// the library has on the shelf: a hold is refused with ErrCopiesFree while
+// some of them are not kept for ready holds.
+func (pg *postgres) PlaceHold(ctx context.Context, username string, libraryUid string, bookUid string, available int) (Hold, error) {
+	hold := Hold{
+		Hold_uid:    uuid.New().String(),
+		Username:    username,
+		Book_uid:    bookUid,
+		Library_uid: libraryUid,
+		Status:      HoldWaiting,
+		Created_at:  time.Now().UTC(),
+	}
+
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return Hold{}, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var ready int
+	query := `SELECT COUNT(*) FROM hold WHERE library_uid = $1 AND book_uid = $2 AND status = $3`
+
+	if err = tx.QueryRow(ctx, query, libraryUid, bookUid, HoldReady).Scan(&ready); err != nil {
+		return Hold{}, fmt.Errorf("unable to query: %w", err)
+	}
+	if available > ready {
+		return Hold{}, ErrCopiesFree
+	}
+
+	query = `INSERT INTO hold (hold_uid, username, book_uid, library_uid, status, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (username, library_uid, book_uid) WHERE status IN ('WAITING', 'READY_FOR_PICKUP') DO NOTHING`
+
+	tag, err := tx.Exec(ctx, query, hold.Hold_uid, username, bookUid, libraryUid, HoldWaiting, hold.Created_at)
+	if err != nil {
+		return Hold{}, fmt.Errorf("unable to insert row: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return Hold{}, ErrHoldExists
+	}
+
+	if err = outbox.Add(ctx, tx, holdEvent(events.HoldPlaced, hold)); err != nil {
+		return Hold{}, err
+	}
+
+	hold, err = getHold(ctx, tx, hold.Hold_uid)
+	if err != nil {
+		return Hold{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return Hold{}, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
+	return hold, nil
+}
+
+func (pg *postgres) GetHolds(ctx context.Context, username string) ([]Hold, error) {
+	query := `SELECT ` + holdColumns + ` FROM hold WHERE hold.username = $1 ORDER BY hold.id DESC`
+
+	rows, err := pg.db.Query(ctx, query, username)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query: %w", err)
+	}
+	defer rows.Close()
+
+	holds, err := pgx.CollectRows(rows, pgx.RowToStructByName[Hold])
+	if err != nil {
+		return nil, fmt.Errorf("unable to collect rows: %w", err)
+	}
+
+	return holds, nil
+}
+
+// CancelHold cancels an active hold of username. Cancelling a ready hold
+// passes its copy to the next hold in the queue.
+func (pg *postgres) CancelHold(ctx context.Context, username string, holdUid string) (Hold, error) {
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return Hold{}, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	hold, err := getHold(ctx, tx, holdUid)
+	if err != nil {
+		return Hold{}, err
+	}
+	if hold.Username != username {
+		return Hold{}, ErrHoldNotFound
+	}
+	if hold.Status != HoldWaiting && hold.Status != HoldReady {
+		return Hold{}, ErrHoldInactive
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE hold SET status = $1 WHERE hold_uid = $2`, HoldCancelled, holdUid)
+	if err != nil {
+		return Hold{}, fmt.Errorf("unable to update row: %w", err)
+	}
+
+	if err = outbox.Add(ctx, tx, holdEvent(events.HoldCancelled, hold)); err != nil {
+		return Hold{}, err
+	}
+
+	if hold.Status == HoldReady {
+		if _, err = promoteHold(ctx, tx, hold.Library_uid, hold.Book_uid, time.Now().UTC()); err != nil {
+			return Hold{}, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return Hold{}, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
+	hold.Status, hold.Position = HoldCancelled, 0
+	return hold, nil
+}
+
+// ExpireHolds expires ready holds not picked up by now and passes each copy
+// to the next hold in its queue. It returns the number of expired holds.
+func (pg *postgres) ExpireHolds(ctx context.Context, now time.Time) (int, error) {
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE hold SET status = $1 WHERE status = $2 AND expires_at < $3
+	RETURNING hold_uid, username, book_uid, library_uid`
+
+	rows, err := tx.Query(ctx, query, HoldExpired, HoldReady, now)
+	if err != nil {
+		return 0, fmt.Errorf("unable to query: %w", err)
+	}
+
+	var expired []Hold
+	for rows.Next() {
+		var hold Hold
+		if err := rows.Scan(&hold.Hold_uid, &hold.Username, &hold.Book_uid, &hold.Library_uid); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("unable to scan row: %w", err)
+		}
+		expired = append(expired, hold)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("unable to query: %w", err)
+	}
+
+	for _, hold := range expired {
+		if err := outbox.Add(ctx, tx, holdEvent(events.HoldExpired, hold)); err != nil {
+			return 0, err
+		}
+		if _, err := promoteHold(ctx, tx, hold.Library_uid, hold.Book_uid, now); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
+	return len(expired), nil
+}
+
+func getHold(ctx context.Context, tx pgx.Tx, holdUid string) (Hold, error) {
+	query := `SELECT ` + holdColumns + ` FROM hold WHERE hold.hold_uid = $1`
+
+	rows, err := tx.Query(ctx, query, holdUid)
+	if err != nil {
+		return Hold{}, fmt.Errorf("unable to query: %w", err)
+	}
+	defer rows.Close()
+
+	hold, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[Hold])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Hold{}, ErrHoldNotFound
+	}
+	if err != nil {
+		return Hold{}, fmt.Errorf("unable to collect row: %w", err)
+	}
+
+	return hold, nil
+}
+
+// PromoteHolds passes copies added to the pair to as many waiting holds.
+// eventId identifies the stock change, a change seen before promotes nothing.
+// It returns the number of promoted holds.
+func (pg *postgres) PromoteHolds(ctx context.Context, eventId string, libraryUid string, bookUid string, copies int, now time.Time) (int, error) {
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `INSERT INTO consumed_events (event_id, consumed_at) VALUES ($1, $2) ON CONFLICT (event_id) DO NOTHING`
+
+	tag, err := tx.Exec(ctx, query, eventId, now)
+	if err != nil {
+		return 0, fmt.Errorf("unable to insert row: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return 0, nil
+	}
+
+	promoted := 0
+	for promoted < copies {
+		ok, err := promoteHold(ctx, tx, libraryUid, bookUid, now)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		promoted++
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
+	return promoted, nil
+}
+
+// promoteHold gives a copy of the book that came back to the oldest waiting
+// hold on it, if any. It reports whether a hold was promoted.
+func promoteHold(ctx context.Context, tx pgx.Tx, libraryUid string, bookUid string, now time.Time) (bool, error) {
+	query := `UPDATE hold SET status = $1, ready_at = $2, expires_at = $3
+	WHERE id = (SELECT id FROM hold WHERE library_uid = $4 AND book_uid = $5 AND status = $6
+		ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED)
+	RETURNING hold_uid, username`
+
+	hold := Hold{Book_uid: bookUid, Library_uid: libraryUid}
+	err := tx.QueryRow(ctx, query, HoldReady, now, now.Add(HoldPickupWindow), libraryUid, bookUid, HoldWaiting).
+		Scan(&hold.Hold_uid, &hold.Username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to promote hold: %w", err)
+	}
+
+	if err = outbox.Add(ctx, tx, holdEvent(events.HoldReady, hold)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// claimHold checks that a new reservation of the pair does not take a copy
+// kept for someone else and fulfils the reader's own hold on it.
+func claimHold(ctx context.Context, tx pgx.Tx, username string, libraryUid string, bookUid string) error {
+	var heldForOthers int
+	query := `SELECT COUNT(*) FROM hold WHERE library_uid = $1 AND book_uid = $2 AND status = $3 AND username <> $4`
+
+	err := tx.QueryRow(ctx, query, libraryUid, bookUid, HoldReady, username).Scan(&heldForOthers)
+	if err != nil {
+		return fmt.Errorf("unable to query: %w", err)
+	}
+	if heldForOthers > 0 {
+		return ErrHeldForOther
+	}
+
+	query = `UPDATE hold SET status = $1
+	WHERE username = $2 AND library_uid = $3 AND book_uid = $4 AND status IN ($5, $6)`
+
+	_, err = tx.Exec(ctx, query, HoldFulfilled, username, libraryUid, bookUid, HoldWaiting, HoldReady)
+	if err != nil {
+		return fmt.Errorf("unable to update row: %w", err)
+	}
+
+	return nil
+}
+
+func holdEvent(eventType events.Type, hold Hold) events.Event {
+	event := events.New(eventType, hold.Username)
+	event.HoldUid = hold.Hold_uid
+	event.BookUid = hold.Book_uid
+	event.LibraryUid = hold.Library_uid
+
+	return event
+}
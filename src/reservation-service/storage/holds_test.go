@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"lab2/src/pgtest"
+
+	"github.com/google/uuid"
+)
+
+// holdOf returns the active hold of username on the pair.
+func holdOf(t *testing.T, pg *postgres, username string) Hold {
+	t.Helper()
+
+	holds, err := pg.GetHolds(context.Background(), username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holds) == 0 {
+		t.Fatalf("%s has no holds", username)
+	}
+	return holds[0]
+}
+
+func placeHold(t *testing.T, pg *postgres, libraryUid string, bookUid string) string {
+	t.Helper()
+
+	username := reader()
+	if _, err := pg.PlaceHold(context.Background(), username, libraryUid, bookUid, 0); err != nil {
+		t.Fatal(err)
+	}
+	return username
+}
+
+func TestHoldsServedInOrder(t *testing.T) {
+	pg := &postgres{db: pgtest.Open(t, "reservations")}
+	ctx := context.Background()
+	libraryUid, bookUid := pair()
+
+	reservation := loan(t, pg, libraryUid, bookUid, time.Now().AddDate(0, 0, 14))
+	first := placeHold(t, pg, libraryUid, bookUid)
+	second := placeHold(t, pg, libraryUid, bookUid)
+
+	if hold := holdOf(t, pg, second); hold.Status != HoldWaiting || hold.Position != 2 {
+		t.Fatalf("expected second hold to wait at 2, got %s at %d", hold.Status, hold.Position)
+	}
+
+	if err := pg.UpdateReservationStatus(ctx, reservation.Reservation_uid, StatusReturned); err != nil {
+		t.Fatal(err)
+	}
+
+	if hold := holdOf(t, pg, first); hold.Status != HoldReady {
+		t.Fatalf("expected the returned copy to go to the first hold, got %s", hold.Status)
+	}
+	if hold := holdOf(t, pg, second); hold.Status != HoldWaiting || hold.Position != 1 {
+		t.Fatalf("expected second hold to move up to 1, got %s at %d", hold.Status, hold.Position)
+	}
+
+	_, err := pg.CreateReservation(ctx, "", second, bookUid, libraryUid, time.Now().AddDate(0, 0, 14).Format("2006-01-02"), "EXCELLENT")
+	if !errors.Is(err, ErrHeldForOther) {
+		t.Fatalf("expected the copy kept for the first hold, got %v", err)
+	}
+
+	if _, err := pg.CreateReservation(ctx, "", first, bookUid, libraryUid, time.Now().AddDate(0, 0, 14).Format("2006-01-02"), "EXCELLENT"); err != nil {
+		t.Fatal(err)
+	}
+	if hold := holdOf(t, pg, first); hold.Status != HoldFulfilled {
+		t.Fatalf("expected the first hold to be fulfilled, got %s", hold.Status)
+	}
+}
+
+func TestExpiredHoldPassesCopyOn(t *testing.T) {
+	pg := &postgres{db: pgtest.Open(t, "reservations")}
+	ctx := context.Background()
+	libraryUid, bookUid := pair()
+
+	reservation := loan(t, pg, libraryUid, bookUid, time.Now().AddDate(0, 0, 14))
+	first := placeHold(t, pg, libraryUid, bookUid)
+	second := placeHold(t, pg, libraryUid, bookUid)
+
+	if err := pg.UpdateReservationStatus(ctx, reservation.Reservation_uid, StatusReturned); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pg.ExpireHolds(ctx, time.Now().UTC().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if hold := holdOf(t, pg, first); hold.Status != HoldReady {
+		t.Fatalf("expected the hold to stay ready within the pickup window, got %s", hold.Status)
+	}
+
+	expired, err := pg.ExpireHolds(ctx, time.Now().UTC().Add(HoldPickupWindow+time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired < 1 {
+		t.Fatalf("expected the ready hold to expire, got %d", expired)
+	}
+	if hold := holdOf(t, pg, first); hold.Status != HoldExpired {
+		t.Fatalf("expected first hold to expire, got %s", hold.Status)
+	}
+	if hold := holdOf(t, pg, second); hold.Status != HoldReady {
+		t.Fatalf("expected the copy to pass to the second hold, got %s", hold.Status)
+	}
+}
+
+func TestPromoteHoldsOnAddedCopies(t *testing.T) {
+	pg := &postgres{db: pgtest.Open(t, "reservations")}
+	ctx := context.Background()
+	libraryUid, bookUid := pair()
+
+	first := placeHold(t, pg, libraryUid, bookUid)
+	second := placeHold(t, pg, libraryUid, bookUid)
+	third := placeHold(t, pg, libraryUid, bookUid)
+
+	eventId := uuid.New().String()
+	if promoted, err := pg.PromoteHolds(ctx, eventId, libraryUid, bookUid, 2, time.Now().UTC()); err != nil || promoted != 2 {
+		t.Fatalf("expected two holds promoted, got %d, %v", promoted, err)
+	}
+	if promoted, err := pg.PromoteHolds(ctx, eventId, libraryUid, bookUid, 2, time.Now().UTC()); err != nil || promoted != 0 {
+		t.Fatalf("expected a redelivered event to promote nothing, got %d, %v", promoted, err)
+	}
+
+	for username, want := range map[string]string{first: HoldReady, second: HoldReady, third: HoldWaiting} {
+		if hold := holdOf(t, pg, username); hold.Status != want {
+			t.Errorf("expected %s hold %s, got %s", username, want, hold.Status)
+		}
+	}
+}
+
+func TestPlaceHoldWithFreeCopies(t *testing.T) {
+	pg := &postgres{db: pgtest.Open(t, "reservations")}
+	ctx := context.Background()
+	libraryUid, bookUid := pair()
+
+	if _, err := pg.PlaceHold(ctx, reader(), libraryUid, bookUid, 1); !errors.Is(err, ErrCopiesFree) {
+		t.Fatalf("expected ErrCopiesFree, got %v", err)
+	}
+
+	//the one copy on the shelf is kept for a ready hold
+	placeHold(t, pg, libraryUid, bookUid)
+	if _, err := pg.PromoteHolds(ctx, uuid.New().String(), libraryUid, bookUid, 1, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pg.PlaceHold(ctx, reader(), libraryUid, bookUid, 1); err != nil {
+		t.Fatalf("expected a hold behind the ready one, got %v", err)
+	}
+}
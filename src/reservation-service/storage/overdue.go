@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"lab2/src/events"
+	"lab2/src/outbox"
+	"lab2/src/pagination"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// MarkOverdue moves rented reservations whose till_date is before the day of
+// now to OVERDUE and records a reservation.overdue event for each. It
+// returns the number of reservations marked.
+func (pg *postgres) MarkOverdue(ctx context.Context, now time.Time) (int, error) {
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE reservation SET status = $1 WHERE status = $2 AND till_date < $3
+	RETURNING ` + reservationColumns
+
+	rows, err := tx.Query(ctx, query, StatusOverdue, StatusRented, now.UTC().Truncate(24*time.Hour))
+	if err != nil {
+		return 0, fmt.Errorf("unable to query: %w", err)
+	}
+
+	overdue, err := pgx.CollectRows(rows, pgx.RowToStructByName[Reservation])
+	if err != nil {
+		return 0, fmt.Errorf("unable to collect rows: %w", err)
+	}
+
+	for _, reservation := range overdue {
+		if err := recordStatus(ctx, tx, reservation.Reservation_uid, StatusRented, StatusOverdue); err != nil {
+			return 0, err
+		}
+		if err := outbox.Add(ctx, tx, reservationEvent(events.ReservationOverdue, reservation)); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
+	return len(overdue), nil
+}
+
+func (pg *postgres) GetOverdueReservations(ctx context.Context, page pagination.Page) ([]Reservation, int, error) {
+	var total int
+	err := pg.db.QueryRow(ctx, `SELECT COUNT(*) FROM reservation WHERE status = $1`, StatusOverdue).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to count: %w", err)
+	}
+
+	query := `SELECT ` + reservationColumns + ` FROM reservation WHERE status = $1
+	` + page.OrderBy(SortColumns, "id") + ` LIMIT $2 OFFSET $3`
+
+	rows, err := pg.db.Query(ctx, query, StatusOverdue, page.Size, page.Offset())
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to query: %w", err)
+	}
+	defer rows.Close()
+
+	reservations, err := pgx.CollectRows(rows, pgx.RowToStructByName[Reservation])
+	if err != nil {
+		fmt.Printf("CollectRows error: %v", err)
+		return nil, 0, err
+	}
+
+	return reservations, total, nil
+}
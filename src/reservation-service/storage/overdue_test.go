@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"lab2/src/pgtest"
+)
+
+func TestMarkOverdue(t *testing.T) {
+	pg := &postgres{db: pgtest.Open(t, "reservations")}
+	ctx := context.Background()
+	libraryUid, bookUid := pair()
+
+	now := time.Now().UTC()
+	due := loan(t, pg, libraryUid, bookUid, now.AddDate(0, 0, -1))
+	dueToday := loan(t, pg, libraryUid, bookUid, now)
+
+	if marked, err := pg.MarkOverdue(ctx, now); err != nil || marked < 1 {
+		t.Fatalf("expected overdue reservations marked, got %d, %v", marked, err)
+	}
+
+	for uid, want := range map[string]string{due.Reservation_uid: StatusOverdue, dueToday.Reservation_uid: StatusRented} {
+		reservation, err := pg.GetReservationByUid(ctx, uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reservation.Status != want {
+			t.Errorf("expected reservation due %s to be %s, got %s", reservation.Till_date.Format("2006-01-02"), want, reservation.Status)
+		}
+	}
+
+	if err := pg.UpdateReservationStatus(ctx, due.Reservation_uid, StatusReturned); err == nil {
+		t.Fatal("expected an overdue loan not to be returned on time")
+	}
+	if err := pg.UpdateReservationStatus(ctx, due.Reservation_uid, StatusReturnedLate); err != nil {
+		t.Fatal(err)
+	}
+}
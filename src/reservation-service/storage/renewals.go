@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"lab2/src/events"
+	"lab2/src/outbox"
+)
+
+// RenewalPolicy limits how far readers can extend their reservations. Each
+// renewal moves till_date by Period, but never past MaxLoan after the start
+// date, and a reservation is renewed at most MaxRenewals times.
+type RenewalPolicy struct {
+	MaxRenewals int
+	Period      time.Duration
+	MaxLoan     time.Duration
+}
+
+var DefaultRenewalPolicy = RenewalPolicy{
+	MaxRenewals: 2,
+	Period:      14 * 24 * time.Hour,
+	MaxLoan:     60 * 24 * time.Hour,
+}
+
+var (
+	ErrReservationNotFound = errors.New("reservation not found")
+	ErrNotRenewable        = errors.New("only rented reservations can be renewed")
+	ErrRenewalLimit        = errors.New("renewal limit reached")
+	ErrLoanLimit           = errors.New("maximum loan length reached")
+	ErrHoldsPending        = errors.New("other readers are waiting for this book")
+)
+
+type Renewal struct {
+	Reservation Reservation
+	Renewals    int
+}
+
+// RenewReservation extends a rented reservation of username by one renewal
+// period. Books other readers hold are not renewed.
+func (pg *postgres) RenewReservation(ctx context.Context, username string, reservationUid string, policy RenewalPolicy) (Renewal, error) {
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return Renewal{}, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	reservation, err := lockReservation(ctx, tx, reservationUid)
+	if err != nil {
+		return Renewal{}, err
+	}
+
+	if reservation.Username != username {
+		return Renewal{}, ErrReservationNotFound
+	}
+	if reservation.Status != StatusRented {
+		return Renewal{}, ErrNotRenewable
+	}
+
+	var renewals int
+	err = tx.QueryRow(ctx, `SELECT COUNT(*) FROM renewal WHERE reservation_uid = $1`, reservationUid).Scan(&renewals)
+	if err != nil {
+		return Renewal{}, fmt.Errorf("unable to query: %w", err)
+	}
+	if renewals >= policy.MaxRenewals {
+		return Renewal{}, ErrRenewalLimit
+	}
+
+	tillDate := reservation.Till_date.Add(policy.Period)
+	if maxTillDate := reservation.Start_date.Add(policy.MaxLoan); tillDate.After(maxTillDate) {
+		tillDate = maxTillDate
+	}
+	if !tillDate.After(reservation.Till_date) {
+		return Renewal{}, ErrLoanLimit
+	}
+
+	var waiting int
+	query := `SELECT COUNT(*) FROM hold WHERE library_uid = $1 AND book_uid = $2 AND status = $3`
+	err = tx.QueryRow(ctx, query, reservation.Library_uid, reservation.Book_uid, HoldWaiting).Scan(&waiting)
+	if err != nil {
+		return Renewal{}, fmt.Errorf("unable to query: %w", err)
+	}
+	if waiting > 0 {
+		return Renewal{}, ErrHoldsPending
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE reservation SET till_date = $1 WHERE reservation_uid = $2`, tillDate, reservationUid)
+	if err != nil {
+		return Renewal{}, fmt.Errorf("unable to update row: %w", err)
+	}
+
+	query = `INSERT INTO renewal (reservation_uid, old_till_date, new_till_date, renewed_at) VALUES ($1, $2, $3, $4)`
+	_, err = tx.Exec(ctx, query, reservationUid, reservation.Till_date, tillDate, time.Now().UTC())
+	if err != nil {
+		return Renewal{}, fmt.Errorf("unable to insert row: %w", err)
+	}
+
+	reservation.Till_date = tillDate
+
+	if err = outbox.Add(ctx, tx, reservationEvent(events.ReservationRenewed, reservation)); err != nil {
+		return Renewal{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return Renewal{}, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
+	return Renewal{Reservation: reservation, Renewals: renewals + 1}, nil
+}
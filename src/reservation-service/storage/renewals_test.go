@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"lab2/src/pgtest"
+)
+
+func TestRenewalLimit(t *testing.T) {
+	pg := &postgres{db: pgtest.Open(t, "reservations")}
+	ctx := context.Background()
+	libraryUid, bookUid := pair()
+
+	reservation := loan(t, pg, libraryUid, bookUid, time.Now().AddDate(0, 0, 14))
+	policy := RenewalPolicy{MaxRenewals: 2, Period: 7 * 24 * time.Hour, MaxLoan: 60 * 24 * time.Hour}
+
+	for i := 1; i <= policy.MaxRenewals; i++ {
+		renewal, err := pg.RenewReservation(ctx, reservation.Username, reservation.Reservation_uid, policy)
+		if err != nil {
+			t.Fatalf("renewal %d: %v", i, err)
+		}
+		if renewal.Renewals != i {
+			t.Fatalf("expected renewal %d, got %d", i, renewal.Renewals)
+		}
+		if want := reservation.Till_date.Add(time.Duration(i) * policy.Period); !renewal.Reservation.Till_date.Equal(want) {
+			t.Fatalf("expected till date %s, got %s", want, renewal.Reservation.Till_date)
+		}
+	}
+
+	if _, err := pg.RenewReservation(ctx, reservation.Username, reservation.Reservation_uid, policy); !errors.Is(err, ErrRenewalLimit) {
+		t.Fatalf("expected ErrRenewalLimit, got %v", err)
+	}
+}
+
+func TestRenewalLoanLimit(t *testing.T) {
+	pg := &postgres{db: pgtest.Open(t, "reservations")}
+	ctx := context.Background()
+	libraryUid, bookUid := pair()
+
+	reservation := loan(t, pg, libraryUid, bookUid, time.Now().AddDate(0, 0, 14))
+	policy := RenewalPolicy{MaxRenewals: 5, Period: 14 * 24 * time.Hour, MaxLoan: 20 * 24 * time.Hour}
+
+	renewal, err := pg.RenewReservation(ctx, reservation.Username, reservation.Reservation_uid, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := reservation.Start_date.Add(policy.MaxLoan); !renewal.Reservation.Till_date.Equal(want) {
+		t.Fatalf("expected the renewal capped at %s, got %s", want, renewal.Reservation.Till_date)
+	}
+
+	if _, err := pg.RenewReservation(ctx, reservation.Username, reservation.Reservation_uid, policy); !errors.Is(err, ErrLoanLimit) {
+		t.Fatalf("expected ErrLoanLimit, got %v", err)
+	}
+}
+
+func TestRenewalWithWaitingHolds(t *testing.T) {
+	pg := &postgres{db: pgtest.Open(t, "reservations")}
+	libraryUid, bookUid := pair()
+
+	reservation := loan(t, pg, libraryUid, bookUid, time.Now().AddDate(0, 0, 14))
+	placeHold(t, pg, libraryUid, bookUid)
+
+	_, err := pg.RenewReservation(context.Background(), reservation.Username, reservation.Reservation_uid, DefaultRenewalPolicy)
+	if !errors.Is(err, ErrHoldsPending) {
+		t.Fatalf("expected ErrHoldsPending, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"lab2/src/events"
+	"lab2/src/outbox"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Reservation statuses. A reservation is PENDING while the gateway saga takes
+// the book and RENTED once it has. Loans past their till date become OVERDUE
+// and end RETURNED, RETURNED_LATE or LOST; CANCELLED undoes a reservation
+// that never turned into a loan.
+const (
+	StatusPending      = "PENDING"
+	StatusRented       = "RENTED"
+	StatusOverdue      = "OVERDUE"
+	StatusReturned     = "RETURNED"
+	StatusReturnedLate = "RETURNED_LATE"
+	StatusCancelled    = "CANCELLED"
+	StatusLost         = "LOST"
+)
+
+var ErrIllegalTransition = errors.New("illegal status transition")
+
+var transitions = map[string][]string{
+	StatusPending: {StatusRented, StatusCancelled},
+	StatusRented:  {StatusOverdue, StatusReturned, StatusReturnedLate, StatusCancelled, StatusLost},
+	StatusOverdue: {StatusReturnedLate, StatusLost},
+}
+
+// activeStatuses are the statuses of reservations whose book is out.
+var activeStatuses = []string{StatusPending, StatusRented, StatusOverdue}
+
+func CanTransition(from string, to string) bool {
+	for _, status := range transitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// statusEvents maps a new reservation status to the event recorded with it.
+var statusEvents = map[string]events.Type{
+	StatusReturned:     events.ReservationReturned,
+	StatusReturnedLate: events.ReservationReturnedLate,
+	StatusCancelled:    events.ReservationCancelled,
+	StatusOverdue:      events.ReservationOverdue,
+}
+
+// UpdateReservationStatus moves a reservation to status if the state machine
+// allows it, records the change in the status history together with its
+// event and, when a copy comes back, passes it to the next hold.
+func (pg *postgres) UpdateReservationStatus(ctx context.Context, reservation_uid string, status string) error {
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = transition(ctx, tx, reservation_uid, status); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func transition(ctx context.Context, tx pgx.Tx, reservationUid string, status string) (Reservation, error) {
+	reservation, err := lockReservation(ctx, tx, reservationUid)
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	if !CanTransition(reservation.Status, status) {
+		return Reservation{}, fmt.Errorf("%w from %s to %s", ErrIllegalTransition, reservation.Status, status)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE reservation SET status = $1 WHERE reservation_uid = $2`, status, reservationUid)
+	if err != nil {
+		return Reservation{}, fmt.Errorf("unable to update row: %w", err)
+	}
+
+	from := reservation.Status
+	if err = recordStatus(ctx, tx, reservationUid, from, status); err != nil {
+		return Reservation{}, err
+	}
+	reservation.Status = status
+
+	if eventType, ok := statusEvents[status]; ok {
+		if err = outbox.Add(ctx, tx, reservationEvent(eventType, reservation)); err != nil {
+			return Reservation{}, err
+		}
+	}
+
+	//the copy given back goes to the next reader in the queue
+	if givesBackCopy(from, status) {
+		if _, err = promoteHold(ctx, tx, reservation.Library_uid, reservation.Book_uid, time.Now().UTC()); err != nil {
+			return Reservation{}, err
+		}
+	}
+
+	return reservation, nil
+}
+
+// givesBackCopy reports whether a loan ending this way puts its copy back on
+// the shelf. A PENDING reservation never had a copy handed out; a copy the
+// gateway saga took for it is returned to stock by the saga compensation and
+// is free to be reserved again.
+func givesBackCopy(from string, to string) bool {
+	if from != StatusRented && from != StatusOverdue {
+		return false
+	}
+	return to == StatusReturned || to == StatusReturnedLate || to == StatusCancelled
+}
+
+// lockReservation reads a reservation and locks its row until tx ends.
+func lockReservation(ctx context.Context, tx pgx.Tx, reservationUid string) (Reservation, error) {
+	query := `SELECT ` + reservationColumns + ` FROM reservation WHERE reservation_uid = $1 FOR UPDATE`
+
+	rows, err := tx.Query(ctx, query, reservationUid)
+	if err != nil {
+		return Reservation{}, fmt.Errorf("unable to query: %w", err)
+	}
+	reservation, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[Reservation])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Reservation{}, ErrReservationNotFound
+	}
+	if err != nil {
+		return Reservation{}, fmt.Errorf("unable to collect row: %w", err)
+	}
+
+	return reservation, nil
+}
+
+// recordStatus appends to the status history; from is empty for a new
+// reservation.
+func recordStatus(ctx context.Context, tx pgx.Tx, reservationUid string, from string, to string) error {
+	query := `INSERT INTO reservation_status_history (reservation_uid, from_status, to_status, changed_at)
+	VALUES ($1, NULLIF($2, ''), $3, $4)`
+
+	if _, err := tx.Exec(ctx, query, reservationUid, from, to, time.Now().UTC()); err != nil {
+		return fmt.Errorf("unable to insert row: %w", err)
+	}
+	return nil
+}
@@ -2,12 +2,18 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
+	"lab2/src/events"
+	"lab2/src/outbox"
+	"lab2/src/pagination"
+
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -20,6 +26,8 @@ type Reservation struct {
 	Status          string    `json:"status"`
 	Start_date      time.Time `json:"start_date"`
 	Till_date       time.Time `json:"till_date"`
+	//condition of the book when it was taken, nil for older reservations
+	Checkout_condition *string `json:"checkout_condition"`
 }
 
 type ReservationAmount struct {
@@ -27,16 +35,51 @@ type ReservationAmount struct {
 }
 
 type Storage interface {
-	GetReservations(ctx context.Context, username string) ([]Reservation, error)
-	GetReservationsAll(ctx context.Context) ([]Reservation, error)
+	GetReservations(ctx context.Context, username string, page pagination.Page) ([]Reservation, int, error)
+	GetReservationsAll(ctx context.Context, page pagination.Page) ([]Reservation, int, error)
+	GetOverdueReservations(ctx context.Context, page pagination.Page) ([]Reservation, int, error)
+	MarkOverdue(ctx context.Context, now time.Time) (int, error)
 	GetReservationByUid(ctx context.Context, reservation_uid string) (Reservation, error)
 	GetRentedReservationAmount(ctx context.Context, username string) (ReservationAmount, error)
-	CreateReservation(ctx context.Context, username string, bookUid string, libraryUid string, tillDate string) (Reservation, error)
+	GetActiveReservationAmount(ctx context.Context, libraryUid string, bookUid string) (ReservationAmount, error)
+	CreateReservation(ctx context.Context, reservationUid string, username string, bookUid string, libraryUid string, tillDate string, condition string) (Reservation, error)
 	UpdateReservationStatus(ctx context.Context, reservation_uid string, status string) error
+	RenewReservation(ctx context.Context, username string, reservationUid string, policy RenewalPolicy) (Renewal, error)
+	CancelReservation(ctx context.Context, username string, reservationUid string, window time.Duration, now time.Time) (Reservation, error)
+	ReturnReservation(ctx context.Context, reservationUid string, returned time.Time, condition string, tariff Tariff) (Reservation, []FineEntry, error)
+	GetFineBalance(ctx context.Context, username string) (int, error)
+	GetFines(ctx context.Context, username string, page pagination.Page) ([]FineEntry, int, error)
+	GetDebtors(ctx context.Context, page pagination.Page) ([]Debtor, int, error)
+	SettleFines(ctx context.Context, actor string, username string, kind string, amount int, note string) (FineEntry, error)
+
+	PlaceHold(ctx context.Context, username string, libraryUid string, bookUid string, available int) (Hold, error)
+	GetHolds(ctx context.Context, username string) ([]Hold, error)
+	CancelHold(ctx context.Context, username string, holdUid string) (Hold, error)
+	ExpireHolds(ctx context.Context, now time.Time) (int, error)
+	PromoteHolds(ctx context.Context, eventId string, libraryUid string, bookUid string, copies int, now time.Time) (int, error)
+}
+
+// database is implemented by *pgxpool.Pool; tests replace it with a
+// pgtest.Recorder.
+type database interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Ping(ctx context.Context) error
+	Close()
 }
 
 type postgres struct {
-	db *pgxpool.Pool
+	db database
+}
+
+const reservationColumns = `id, reservation_uid, username, book_uid, library_uid, status, start_date, till_date, checkout_condition`
+
+var SortColumns = pagination.Columns{
+	"startDate": "start_date",
+	"tillDate":  "till_date",
+	"status":    "status",
 }
 
 func NewPgStorage(ctx context.Context, connString string) (*postgres, error) {
@@ -63,54 +106,95 @@ func (pg *postgres) Close() {
 	pg.db.Close()
 }
 
-func (pg *postgres) CreateReservation(ctx context.Context, username string, bookUid string, libraryUid string, tillDate string) (Reservation, error) {
+func (pg *postgres) CreateReservation(ctx context.Context, reservationUid string, username string, bookUid string, libraryUid string, tillDate string, condition string) (Reservation, error) {
 
 	var reservation Reservation
 
-	uid := uuid.New()
+	reservation_uid := reservationUid
+	if reservation_uid == "" {
+		reservation_uid = uuid.New().String()
+	}
 
-	reservation_uid := uid.String()
+	tillDateTime, err := time.Parse("2006-01-02", tillDate)
+	if err != nil {
+		return reservation, fmt.Errorf("unable to convert time: %w", err)
+	}
 
-	start_date := time.Now().UTC().Format("2006-01-02")
+	//the start time is kept in full for the cancellation window
+	start_date := time.Now().UTC()
 
-	query := `INSERT INTO reservation (reservation_uid, username, book_uid, library_uid, status, start_date, till_date) 
-	VALUES (@reservation_uid, @username, @book_uid, @library_uid, @status, @start_date, @till_date)`
+	query := `INSERT INTO reservation (reservation_uid, username, book_uid, library_uid, status, start_date, till_date, checkout_condition) 
+	VALUES (@reservation_uid, @username, @book_uid, @library_uid, @status, @start_date, @till_date, NULLIF(@checkout_condition, ''))
+	ON CONFLICT (reservation_uid) DO NOTHING`
 	args := pgx.NamedArgs{
-		"reservation_uid": reservation_uid,
-		"username":        username,
-		"book_uid":        bookUid,
-		"library_uid":     libraryUid,
-		"status":          "RENTED",
-		"start_date":      start_date,
-		"till_date":       tillDate,
-	}
-	_, err := pg.db.Exec(ctx, query, args)
+		"reservation_uid":    reservation_uid,
+		"username":           username,
+		"book_uid":           bookUid,
+		"library_uid":        libraryUid,
+		"status":             StatusPending,
+		"start_date":         start_date,
+		"till_date":          tillDateTime,
+		"checkout_condition": condition,
+	}
+	tx, err := pg.db.Begin(ctx)
 	if err != nil {
-		return reservation, fmt.Errorf("unable to insert row: %w", err)
+		return reservation, fmt.Errorf("unable to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	tillDateTime, err := time.Parse("2006-01-02", tillDate)
+	tag, err := tx.Exec(ctx, query, args)
 	if err != nil {
-		fmt.Println(err)
-		return reservation, fmt.Errorf("unable to convert time: %w", err)
+		return reservation, fmt.Errorf("unable to insert row: %w", err)
+	}
+
+	//repeated request with the same reservation_uid
+	if tag.RowsAffected() == 0 {
+		reservation, err = pg.GetReservationByUid(ctx, reservation_uid)
+		if err != nil {
+			return reservation, err
+		}
+		if reservation.Username != username {
+			return Reservation{}, errors.New("reservation uid already in use")
+		}
+		return reservation, nil
+	}
+
+	if err = claimHold(ctx, tx, username, libraryUid, bookUid); err != nil {
+		return Reservation{}, err
 	}
 
 	reservation.Reservation_uid = reservation_uid
 	reservation.Username = username
 	reservation.Book_uid = bookUid
 	reservation.Library_uid = libraryUid
-	reservation.Status = "RENTED"
-	reservation.Start_date = time.Now().UTC()
+	reservation.Status = StatusPending
+	reservation.Start_date = start_date
 	reservation.Till_date = tillDateTime
+	if condition != "" {
+		reservation.Checkout_condition = &condition
+	}
+
+	if err = recordStatus(ctx, tx, reservation_uid, "", StatusPending); err != nil {
+		return Reservation{}, err
+	}
+
+	err = outbox.Add(ctx, tx, reservationEvent(events.ReservationCreated, reservation))
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return Reservation{}, fmt.Errorf("unable to commit transaction: %w", err)
+	}
 
 	return reservation, nil
 }
 
 func (pg *postgres) GetReservationByUid(ctx context.Context, reservation_uid string) (Reservation, error) {
 
-	query := fmt.Sprintf(`SELECT * FROM reservation WHERE reservation_uid = '%s'`, reservation_uid)
+	query := `SELECT ` + reservationColumns + ` FROM reservation WHERE reservation_uid = $1`
 
-	rows, err := pg.db.Query(ctx, query)
+	rows, err := pg.db.Query(ctx, query, reservation_uid)
 
 	var reservation Reservation
 
@@ -128,80 +212,100 @@ func (pg *postgres) GetReservationByUid(ctx context.Context, reservation_uid str
 	return reservation, nil
 }
 
-func (pg *postgres) GetReservations(ctx context.Context, username string) ([]Reservation, error) {
+func (pg *postgres) GetReservations(ctx context.Context, username string, page pagination.Page) ([]Reservation, int, error) {
+	var total int
+	err := pg.db.QueryRow(ctx, `SELECT COUNT(*) FROM reservation WHERE username = $1`, username).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to count: %w", err)
+	}
 
-	query := fmt.Sprintf(`SELECT * FROM reservation WHERE username = '%s'`, username)
+	query := `SELECT ` + reservationColumns + ` FROM reservation WHERE username = $1
+	` + page.OrderBy(SortColumns, "id") + ` LIMIT $2 OFFSET $3`
 
-	rows, err := pg.db.Query(ctx, query)
+	rows, err := pg.db.Query(ctx, query, username, page.Size, page.Offset())
 
 	var reservations []Reservation
 
 	if err != nil {
-		return reservations, fmt.Errorf("unable to query: %w", err)
+		return reservations, 0, fmt.Errorf("unable to query: %w", err)
 	}
 	defer rows.Close()
 
 	reservations, err = pgx.CollectRows(rows, pgx.RowToStructByName[Reservation])
 	if err != nil {
 		fmt.Printf("CollectRows error: %v", err)
-		return reservations, err
+		return reservations, 0, err
 	}
 
-	return reservations, nil
+	return reservations, total, nil
 }
 
-func (pg *postgres) GetReservationsAll(ctx context.Context) ([]Reservation, error) {
+func (pg *postgres) GetReservationsAll(ctx context.Context, page pagination.Page) ([]Reservation, int, error) {
+	var total int
+	err := pg.db.QueryRow(ctx, `SELECT COUNT(*) FROM reservation`).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to count: %w", err)
+	}
 
-	query := `SELECT * FROM reservation`
+	query := `SELECT ` + reservationColumns + ` FROM reservation
+	` + page.OrderBy(SortColumns, "id") + ` LIMIT $1 OFFSET $2`
 
-	rows, err := pg.db.Query(ctx, query)
+	rows, err := pg.db.Query(ctx, query, page.Size, page.Offset())
 
 	var reservations []Reservation
 
 	if err != nil {
-		return reservations, fmt.Errorf("unable to query: %w", err)
+		return reservations, 0, fmt.Errorf("unable to query: %w", err)
 	}
 	defer rows.Close()
 
 	reservations, err = pgx.CollectRows(rows, pgx.RowToStructByName[Reservation])
 	if err != nil {
 		fmt.Printf("CollectRows error: %v", err)
-		return reservations, err
+		return reservations, 0, err
 	}
 
-	return reservations, nil
+	return reservations, total, nil
 }
 
 func (pg *postgres) GetRentedReservationAmount(ctx context.Context, username string) (ReservationAmount, error) {
 
-	query := fmt.Sprintf(`SELECT * FROM reservation WHERE username = '%s' and status = 'RENTED'`, username)
-
-	rows, err := pg.db.Query(ctx, query)
+	query := `SELECT COUNT(*) FROM reservation WHERE username = $1 AND status = ANY($2)`
 
 	var reservationAmount ReservationAmount
 
+	err := pg.db.QueryRow(ctx, query, username, activeStatuses).Scan(&reservationAmount.Amount)
 	if err != nil {
 		return reservationAmount, fmt.Errorf("unable to query: %w", err)
 	}
-	defer rows.Close()
 
-	reservations, err := pgx.CollectRows(rows, pgx.RowToStructByName[Reservation])
+	return reservationAmount, nil
+}
+
+// GetActiveReservationAmount counts the copies of a book out on loan from a
+// library.
+func (pg *postgres) GetActiveReservationAmount(ctx context.Context, libraryUid string, bookUid string) (ReservationAmount, error) {
+	query := `SELECT COUNT(*) FROM reservation WHERE library_uid = $1 AND book_uid = $2 AND status = ANY($3)`
+
+	var reservationAmount ReservationAmount
+
+	err := pg.db.QueryRow(ctx, query, libraryUid, bookUid, activeStatuses).Scan(&reservationAmount.Amount)
 	if err != nil {
-		fmt.Printf("CollectRows error: %v", err)
-		return reservationAmount, err
+		return reservationAmount, fmt.Errorf("unable to query: %w", err)
 	}
-	reservationAmount.Amount = len(reservations)
 
 	return reservationAmount, nil
 }
 
-func (pg *postgres) UpdateReservationStatus(ctx context.Context, reservation_uid string, status string) error {
-	query := fmt.Sprintf(`UPDATE reservation SET status = '%s' WHERE reservation_uid = '%s'`, status, reservation_uid)
+func (pg *postgres) Outbox() outbox.Store {
+	return outbox.NewPgStore(pg.db)
+}
 
-	_, err := pg.db.Exec(ctx, query)
-	if err != nil {
-		return fmt.Errorf("unable to insert row: %w", err)
-	}
+func reservationEvent(eventType events.Type, reservation Reservation) events.Event {
+	event := events.New(eventType, reservation.Username)
+	event.ReservationUid = reservation.Reservation_uid
+	event.BookUid = reservation.Book_uid
+	event.LibraryUid = reservation.Library_uid
 
-	return nil
+	return event
 }
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"lab2/src/pagination"
+	"lab2/src/pgtest"
+
+	"github.com/google/uuid"
+)
+
+const injection = `x' OR '1'='1'; DROP TABLE reservation; --`
+
+func TestQueriesBindUserInput(t *testing.T) {
+	cases := map[string]func(pg *postgres) error{
+		"GetReservations": func(pg *postgres) error {
+			_, _, err := pg.GetReservations(context.Background(), injection, pagination.Page{Number: 1, Size: 10, Sort: "startDate"})
+			return err
+		},
+		"GetReservationByUid": func(pg *postgres) error {
+			_, err := pg.GetReservationByUid(context.Background(), injection)
+			return err
+		},
+		"GetRentedReservationAmount": func(pg *postgres) error {
+			_, err := pg.GetRentedReservationAmount(context.Background(), injection)
+			return err
+		},
+		"CreateReservation": func(pg *postgres) error {
+			_, err := pg.CreateReservation(context.Background(), "", injection, "book", "library", "2024-01-01", "EXCELLENT")
+			return err
+		},
+		"RenewReservation": func(pg *postgres) error {
+			_, err := pg.RenewReservation(context.Background(), "user", injection, DefaultRenewalPolicy)
+			return err
+		},
+		"PlaceHold": func(pg *postgres) error {
+			_, err := pg.PlaceHold(context.Background(), "user", injection, "book", 0)
+			return err
+		},
+		"GetHolds": func(pg *postgres) error {
+			_, err := pg.GetHolds(context.Background(), injection)
+			return err
+		},
+		"CancelHold": func(pg *postgres) error {
+			_, err := pg.CancelHold(context.Background(), "user", injection)
+			return err
+		},
+		"CancelReservation": func(pg *postgres) error {
+			_, err := pg.CancelReservation(context.Background(), "user", injection, DefaultCancelWindow, time.Now())
+			return err
+		},
+		"ReturnReservation": func(pg *postgres) error {
+			_, _, err := pg.ReturnReservation(context.Background(), injection, time.Now(), "GOOD", DefaultTariff)
+			return err
+		},
+		"GetFineBalance": func(pg *postgres) error {
+			_, err := pg.GetFineBalance(context.Background(), injection)
+			return err
+		},
+		"GetFines": func(pg *postgres) error {
+			_, _, err := pg.GetFines(context.Background(), injection, pagination.Page{Number: 1, Size: 10})
+			return err
+		},
+		"SettleFines": func(pg *postgres) error {
+			_, err := pg.SettleFines(context.Background(), "admin", injection, FineWaiver, 10, "")
+			return err
+		},
+		"UpdateReservationStatus": func(pg *postgres) error {
+			return pg.UpdateReservationStatus(context.Background(), injection, StatusReturned)
+		},
+	}
+
+	for name, call := range cases {
+		t.Run(name, func(t *testing.T) {
+			recorder := &pgtest.Recorder{}
+			if err := call(&postgres{db: recorder}); err == nil {
+				t.Fatal("expected recorded error")
+			}
+			recorder.AssertBound(t, injection)
+		})
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	cases := []struct {
+		from, to string
+		want     bool
+	}{
+		{StatusPending, StatusRented, true},
+		{StatusPending, StatusCancelled, true},
+		{StatusPending, StatusReturned, false},
+		{StatusRented, StatusOverdue, true},
+		{StatusRented, StatusReturned, true},
+		{StatusRented, StatusLost, true},
+		{StatusOverdue, StatusReturnedLate, true},
+		{StatusOverdue, StatusReturned, false},
+		{StatusOverdue, StatusCancelled, false},
+		{StatusReturned, StatusReturned, false},
+		{StatusReturnedLate, StatusRented, false},
+		{StatusCancelled, StatusRented, false},
+		{StatusLost, StatusReturnedLate, false},
+		{StatusRented, "EXPIRED", false},
+	}
+
+	for _, tc := range cases {
+		if got := CanTransition(tc.from, tc.to); got != tc.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tc.from, tc.to, got, tc.want)
+		}
+	}
+}
+
+func TestTariffAssess(t *testing.T) {
+	excellent := "EXCELLENT"
+	reservation := Reservation{
+		Till_date:          time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC),
+		Checkout_condition: &excellent,
+	}
+	tariff := Tariff{PerDayOverdue: 10, PerConditionLevel: 150}
+
+	if fines := tariff.Assess(reservation, time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), "EXCELLENT"); len(fines) != 0 {
+		t.Errorf("expected no fines for an on time return, got %v", fines)
+	}
+
+	fines := tariff.Assess(reservation, time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC), "BAD")
+	if len(fines) != 2 {
+		t.Fatalf("expected overdue and damage fines, got %v", fines)
+	}
+	if fines[0].Kind != FineOverdue || fines[0].Amount != 30 {
+		t.Errorf("unexpected overdue fine %+v", fines[0])
+	}
+	if fines[1].Kind != FineDamage || fines[1].Amount != 300 {
+		t.Errorf("unexpected damage fine %+v", fines[1])
+	}
+
+	reservation.Checkout_condition = nil
+	if fines := tariff.Assess(reservation, reservation.Till_date, "BAD"); len(fines) != 0 {
+		t.Errorf("expected no damage fine without checkout condition, got %v", fines)
+	}
+}
+
+// loan rents a copy of the pair to a new reader until till and returns the
+// reservation.
+func loan(t *testing.T, pg *postgres, libraryUid string, bookUid string, till time.Time) Reservation {
+	t.Helper()
+	ctx := context.Background()
+
+	reservation, err := pg.CreateReservation(ctx, "", reader(), bookUid, libraryUid, till.Format("2006-01-02"), "EXCELLENT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pg.UpdateReservationStatus(ctx, reservation.Reservation_uid, StatusRented); err != nil {
+		t.Fatal(err)
+	}
+
+	reservation, err = pg.GetReservationByUid(ctx, reservation.Reservation_uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reservation
+}
+
+func reader() string {
+	return "reader-" + uuid.New().String()[:8]
+}
+
+func pair() (string, string) {
+	return uuid.New().String(), uuid.New().String()
+}
@@ -0,0 +1,109 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CacheTTL bounds how long a genre or city stays cached, so that a book or
+// library edited in library-service is picked up by later events.
+const CacheTTL = time.Hour
+
+// Client looks up book genres and library cities in library-service. Found
+// values are cached for CacheTTL; failed lookups are not, so they are retried
+// with the next event.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu     sync.Mutex
+	genres map[string]entry
+	cities map[string]entry
+}
+
+type entry struct {
+	value    string
+	storedAt time.Time
+}
+
+type bookResponse struct {
+	Genre string `json:"genre"`
+}
+
+type libraryResponse struct {
+	City string `json:"city"`
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    baseURL,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		now:        time.Now,
+		genres:     make(map[string]entry),
+		cities:     make(map[string]entry),
+	}
+}
+
+func (cl *Client) Genre(ctx context.Context, bookUid string) (string, error) {
+	if bookUid == "" {
+		return "", nil
+	}
+
+	return cl.lookup(ctx, cl.genres, bookUid, fmt.Sprintf("%s/api/v1/books/%s/", cl.baseURL, bookUid), func(body *json.Decoder) (string, error) {
+		var book bookResponse
+		err := body.Decode(&book)
+		return book.Genre, err
+	})
+}
+
+func (cl *Client) City(ctx context.Context, libraryUid string) (string, error) {
+	if libraryUid == "" {
+		return "", nil
+	}
+
+	return cl.lookup(ctx, cl.cities, libraryUid, fmt.Sprintf("%s/api/v1/libraries/%s/", cl.baseURL, libraryUid), func(body *json.Decoder) (string, error) {
+		var library libraryResponse
+		err := body.Decode(&library)
+		return library.City, err
+	})
+}
+
+func (cl *Client) lookup(ctx context.Context, cache map[string]entry, key string, url string, decode func(*json.Decoder) (string, error)) (string, error) {
+	cl.mu.Lock()
+	cached, ok := cache[key]
+	cl.mu.Unlock()
+	if ok && cl.now().Sub(cached.storedAt) < CacheTTL {
+		return cached.value, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := cl.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("library service unavailable: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("library service responded with %d", res.StatusCode)
+	}
+
+	value, err := decode(json.NewDecoder(res.Body))
+	if err != nil {
+		return "", fmt.Errorf("unable to decode library service response: %w", err)
+	}
+
+	cl.mu.Lock()
+	cache[key] = entry{value: value, storedAt: cl.now()}
+	cl.mu.Unlock()
+
+	return value, nil
+}
@@ -0,0 +1,42 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGenreExpires(t *testing.T) {
+	//the book changes genre after the first lookup
+	var lookups atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		genre := "Роман"
+		if lookups.Add(1) == 1 {
+			genre = "Научная фантастика"
+		}
+		fmt.Fprintf(w, `{"genre": %q}`, genre)
+	}))
+	defer server.Close()
+
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	client := NewClient(server.URL)
+	client.now = func() time.Time { return now }
+
+	if got, err := client.Genre(context.Background(), "book"); err != nil || got != "Научная фантастика" {
+		t.Fatalf("expected genre to be looked up, got %q, %v", got, err)
+	}
+
+	now = now.Add(CacheTTL - time.Minute)
+	if got, _ := client.Genre(context.Background(), "book"); got != "Научная фантастика" {
+		t.Fatalf("expected cached genre, got %q", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got, _ := client.Genre(context.Background(), "book"); got != "Роман" {
+		t.Fatalf("expected genre to be looked up again, got %q", got)
+	}
+}
@@ -1,20 +1,217 @@
 package handler
 
 import (
-	"sync"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"lab2/src/events"
+	"lab2/src/statistics-service/catalog"
+	"lab2/src/statistics-service/storage"
 
 	"github.com/IBM/sarama"
+	"github.com/gin-gonic/gin"
 )
 
-type EventConsumer struct {
-	stats map[string]int
-	mu    sync.RWMutex
+type ErrorResponse struct {
+	Message string `json:"message"`
 }
 
 type StatisticsResponse map[string]int
 
-func NewEventConsumer() *EventConsumer {
-	return &EventConsumer{stats: make(map[string]int)}
+type SeriesPoint struct {
+	Bucket string      `json:"bucket"`
+	Group  string      `json:"group,omitempty"`
+	Type   events.Type `json:"type"`
+	Count  int         `json:"count"`
+}
+
+// BreakdownItem sums a group over the whole window. LateReturnRate is the
+// share of returns made after the due date, or null without returns.
+type BreakdownItem struct {
+	Group          string              `json:"group"`
+	Total          int                 `json:"total"`
+	Counts         map[events.Type]int `json:"counts"`
+	LateReturnRate *float64            `json:"lateReturnRate"`
+}
+
+type ReportResponse struct {
+	From      string          `json:"from"`
+	To        string          `json:"to"`
+	Bucket    string          `json:"bucket,omitempty"`
+	GroupBy   string          `json:"groupBy,omitempty"`
+	Series    []SeriesPoint   `json:"series"`
+	Breakdown []BreakdownItem `json:"breakdown"`
+}
+
+type Handler struct {
+	storage storage.Storage
+}
+
+func NewHandler(storage storage.Storage) *Handler {
+	return &Handler{storage: storage}
+}
+
+// GetStatistics returns event totals by label. With any of the from, to,
+// bucket or groupBy parameters it returns a ReportResponse instead.
+func (h *Handler) GetStatistics(c *gin.Context) {
+	if c.Query("from") != "" || c.Query("to") != "" || c.Query("bucket") != "" || c.Query("groupBy") != "" {
+		h.getReport(c)
+		return
+	}
+
+	counts, err := h.storage.CountByType(context.Background())
+	if err != nil {
+		fmt.Printf("failed to get statistics %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	result := make(StatisticsResponse, len(counts))
+	for eventType, count := range counts {
+		result[eventType.Label()] += count
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) getReport(c *gin.Context) {
+	query, err := parseQuery(c.Query("from"), c.Query("to"), c.Query("bucket"), c.Query("groupBy"), time.Now().UTC())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	rows, err := h.storage.Query(context.Background(), query)
+	if err != nil {
+		fmt.Printf("failed to get statistics %s\n", err.Error())
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, RowsToReport(query, rows))
+}
+
+func parseQuery(from string, to string, bucket string, groupBy string, now time.Time) (storage.Query, error) {
+	query := storage.Query{
+		From:    now.AddDate(0, 0, -30),
+		To:      now,
+		Bucket:  bucket,
+		GroupBy: groupBy,
+	}
+
+	var err error
+	if from != "" {
+		if query.From, _, err = parseTime(from); err != nil {
+			return query, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if to != "" {
+		var dateOnly bool
+		if query.To, dateOnly, err = parseTime(to); err != nil {
+			return query, fmt.Errorf("invalid to: %w", err)
+		}
+		//a plain date includes the whole day
+		if dateOnly {
+			query.To = query.To.AddDate(0, 0, 1)
+		}
+	}
+	if !query.From.Before(query.To) {
+		return query, errors.New("from must be before to")
+	}
+
+	if !storage.ValidBucket(bucket) {
+		return query, errors.New("bucket must be one of hour, day, week")
+	}
+	if !storage.ValidGroupBy(groupBy) {
+		return query, errors.New("groupBy must be one of library, book, user, genre, city")
+	}
+
+	return query, nil
+}
+
+// parseTime accepts RFC 3339 timestamps and plain dates.
+func parseTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), false, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	return t, true, err
+}
+
+func RowsToReport(query storage.Query, rows []storage.Row) ReportResponse {
+	report := ReportResponse{
+		From:      query.From.Format(time.RFC3339),
+		To:        query.To.Format(time.RFC3339),
+		Bucket:    query.Bucket,
+		GroupBy:   query.GroupBy,
+		Series:    make([]SeriesPoint, 0),
+		Breakdown: make([]BreakdownItem, 0),
+	}
+
+	groups := make(map[string]int)
+	for _, row := range rows {
+		if query.Bucket != "" && row.Bucket != nil {
+			report.Series = append(report.Series, SeriesPoint{
+				Bucket: row.Bucket.Format(time.RFC3339),
+				Group:  row.Group,
+				Type:   row.Type,
+				Count:  row.Count,
+			})
+		}
+
+		index, ok := groups[row.Group]
+		if !ok {
+			index = len(report.Breakdown)
+			groups[row.Group] = index
+			report.Breakdown = append(report.Breakdown, BreakdownItem{
+				Group:  row.Group,
+				Counts: make(map[events.Type]int),
+			})
+		}
+
+		item := &report.Breakdown[index]
+		item.Total += row.Count
+		item.Counts[row.Type] += row.Count
+	}
+
+	for i := range report.Breakdown {
+		item := &report.Breakdown[i]
+		late := item.Counts[events.ReservationReturnedLate]
+		returned := late + item.Counts[events.ReservationReturned]
+		if returned > 0 {
+			rate := float64(late) / float64(returned)
+			item.LateReturnRate = &rate
+		}
+	}
+
+	return report
+}
+
+func (h *Handler) GetHealth(c *gin.Context) {
+	c.Status(http.StatusOK)
+}
+
+// EventConsumer stores consumed events. Offsets are marked only after the
+// event is saved, so a failed insert is consumed again after the session
+// restarts; the store ignores duplicates.
+type EventConsumer struct {
+	storage storage.Storage
+	catalog *catalog.Client
+}
+
+func NewEventConsumer(storage storage.Storage, catalog *catalog.Client) *EventConsumer {
+	return &EventConsumer{storage: storage, catalog: catalog}
 }
 
 func (c *EventConsumer) Setup(_ sarama.ConsumerGroupSession) error {
@@ -27,22 +224,33 @@ func (c *EventConsumer) Cleanup(_ sarama.ConsumerGroupSession) error {
 
 func (c *EventConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	for message := range claim.Messages() {
-		event := string(message.Value)
-		c.mu.Lock()
-		c.stats[event]++
-		c.mu.Unlock()
+		event, err := events.Decode(message.Value)
+		if err != nil {
+			log.Printf("skipping kafka message at offset %d: %v", message.Offset, err)
+			session.MarkMessage(message, "")
+			continue
+		}
+
+		if err := c.storage.SaveEvent(session.Context(), event, c.dimensions(session.Context(), event)); err != nil {
+			return fmt.Errorf("failed to save event %s: %w", event.ID, err)
+		}
 		session.MarkMessage(message, "")
 	}
 	return nil
 }
 
-func (c *EventConsumer) Stats() StatisticsResponse {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+// dimensions never fails: an event whose genre or city cannot be looked up is
+// stored without it rather than blocking the partition.
+func (c *EventConsumer) dimensions(ctx context.Context, event events.Event) storage.Dimensions {
+	var dims storage.Dimensions
+	var err error
 
-	result := make(StatisticsResponse, len(c.stats))
-	for k, v := range c.stats {
-		result[k] = v
+	if dims.Genre, err = c.catalog.Genre(ctx, event.BookUid); err != nil {
+		log.Printf("failed to get genre of book %s: %v", event.BookUid, err)
+	}
+	if dims.City, err = c.catalog.City(ctx, event.LibraryUid); err != nil {
+		log.Printf("failed to get city of library %s: %v", event.LibraryUid, err)
 	}
-	return result
+
+	return dims
 }
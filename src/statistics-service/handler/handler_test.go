@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"lab2/src/events"
+	"lab2/src/statistics-service/storage"
+)
+
+func TestParseQuery(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	query, err := parseQuery("2024-03-01", "2024-03-05", "day", "library", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !query.To.Equal(time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected date-only to to include the day, got %s", query.To)
+	}
+
+	if _, err := parseQuery("", "", "month", "", now); err == nil {
+		t.Fatal("expected error for unknown bucket")
+	}
+	if _, err := parseQuery("", "", "", "library; DROP TABLE events", now); err == nil {
+		t.Fatal("expected error for unknown group")
+	}
+	if _, err := parseQuery("2024-03-05", "2024-03-01", "", "", now); err == nil {
+		t.Fatal("expected error for empty window")
+	}
+}
+
+func TestRowsToReport(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	rows := []storage.Row{
+		{Bucket: &day, Group: "Москва", Type: events.ReservationReturned, Count: 3},
+		{Bucket: &day, Group: "Москва", Type: events.ReservationReturnedLate, Count: 1},
+		{Bucket: &day, Group: "Челябинск", Type: events.ReservationCreated, Count: 2},
+	}
+
+	report := RowsToReport(storage.Query{Bucket: "day", GroupBy: "city"}, rows)
+
+	if len(report.Series) != 3 || len(report.Breakdown) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	moscow := report.Breakdown[0]
+	if moscow.Total != 4 || moscow.LateReturnRate == nil || *moscow.LateReturnRate != 0.25 {
+		t.Fatalf("unexpected breakdown %+v", moscow)
+	}
+	if report.Breakdown[1].LateReturnRate != nil {
+		t.Fatal("expected no late return rate without returns")
+	}
+}
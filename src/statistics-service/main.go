@@ -2,20 +2,31 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"lab2/src/events"
 	"lab2/src/middleware"
+	"lab2/src/statistics-service/catalog"
 	"lab2/src/statistics-service/groupconsumer"
 	"lab2/src/statistics-service/handler"
+	"lab2/src/statistics-service/storage"
 	"log"
-	"net/http"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
-const topic = "events"
-
 func main() {
+	postgresURL := fmt.Sprintf("host=%s port=%d user=%s dbname=%s password=%s",
+		"postgres", 5432, "program", "statistics", "test")
+	psqlDB, err := storage.NewPgStorage(context.Background(), postgresURL)
+	if err != nil {
+		fmt.Printf("Postgresql init: %s", err)
+	} else {
+		fmt.Println("Connected to PostreSQL")
+	}
+	defer psqlDB.Close()
+
 	consumerGroup, err := groupconsumer.InitConsumerGroup()
 	if err != nil {
 		log.Fatalf("failed to create kafka consumer group")
@@ -29,13 +40,14 @@ func main() {
 		}
 	}()
 
-	consumer := handler.NewEventConsumer()
+	consumer := handler.NewEventConsumer(psqlDB, catalog.NewClient("http://library-service:8060"))
+	handler := handler.NewHandler(psqlDB)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	go func() {
 		for {
-			if err := consumerGroup.Consume(ctx, []string{topic}, consumer); err != nil {
+			if err := consumerGroup.Consume(ctx, []string{events.Topic}, consumer); err != nil {
 				log.Printf("error consuming kafka topic: %v", err)
 				time.Sleep(50 * time.Millisecond)
 			}
@@ -63,12 +75,8 @@ func main() {
 		AllowCredentials: true,
 	}))
 
-	router.GET("/api/v1/statistics", jwtMiddleware.Middleware(), func(c *gin.Context) {
-		c.JSON(http.StatusOK, consumer.Stats())
-	})
-	router.GET("/manage/health", func(c *gin.Context) {
-		c.Status(http.StatusOK)
-	})
+	router.GET("/api/v1/statistics", jwtMiddleware.Middleware(), middleware.RequireRole("admin"), handler.GetStatistics)
+	router.GET("/manage/health", handler.GetHealth)
 
 	router.Run(":8040")
 }
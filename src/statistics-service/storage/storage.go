@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"lab2/src/events"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Dimensions are looked up when an event is consumed and stored with it, so
+// reports do not depend on library-service being reachable.
+type Dimensions struct {
+	Genre string
+	City  string
+}
+
+// Query selects events with from <= occurred_at < to. Bucket is one of
+// hour/day/week or empty for no time series, GroupBy one of the keys of
+// groupColumns or empty for a single group.
+type Query struct {
+	From    time.Time
+	To      time.Time
+	Bucket  string
+	GroupBy string
+}
+
+type Row struct {
+	Bucket *time.Time
+	Group  string
+	Type   events.Type
+	Count  int
+}
+
+type Storage interface {
+	SaveEvent(ctx context.Context, event events.Event, dims Dimensions) error
+	CountByType(ctx context.Context) (map[events.Type]int, error)
+	Query(ctx context.Context, q Query) ([]Row, error)
+}
+
+var bucketColumns = map[string]string{
+	"":     "NULL::timestamp",
+	"hour": "date_trunc('hour', occurred_at)",
+	"day":  "date_trunc('day', occurred_at)",
+	"week": "date_trunc('week', occurred_at)",
+}
+
+var groupColumns = map[string]string{
+	"":        "''",
+	"library": "COALESCE(library_uid::text, '')",
+	"book":    "COALESCE(book_uid::text, '')",
+	"user":    "actor",
+	"genre":   "genre",
+	"city":    "city",
+}
+
+func ValidBucket(bucket string) bool {
+	_, ok := bucketColumns[bucket]
+	return ok
+}
+
+func ValidGroupBy(groupBy string) bool {
+	_, ok := groupColumns[groupBy]
+	return ok
+}
+
+type postgres struct {
+	db *pgxpool.Pool
+}
+
+func NewPgStorage(ctx context.Context, connString string) (*postgres, error) {
+	var pgInstance *postgres
+	var pgOnce sync.Once
+	pgOnce.Do(func() {
+		db, err := pgxpool.New(ctx, connString)
+		if err != nil {
+			fmt.Printf("Unable to create connection pool: %v\n", err)
+			return
+		}
+
+		pgInstance = &postgres{db}
+	})
+
+	return pgInstance, nil
+}
+
+func (pg *postgres) Ping(ctx context.Context) error {
+	return pg.db.Ping(ctx)
+}
+
+func (pg *postgres) Close() {
+	pg.db.Close()
+}
+
+// SaveEvent stores event once; redelivered events with a known ID are ignored.
+func (pg *postgres) SaveEvent(ctx context.Context, event events.Event, dims Dimensions) error {
+	query := `INSERT INTO events (event_id, type, schema_version, occurred_at, actor, reservation_uid, book_uid, library_uid, rating_delta, genre, city)
+	VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::uuid, NULLIF($7, '')::uuid, NULLIF($8, '')::uuid, $9, $10, $11)
+	ON CONFLICT (event_id) DO NOTHING`
+
+	_, err := pg.db.Exec(ctx, query, event.ID, event.Type, event.SchemaVersion, event.OccurredAt, event.Actor,
+		event.ReservationUid, event.BookUid, event.LibraryUid, event.RatingDelta, dims.Genre, dims.City)
+	if err != nil {
+		return fmt.Errorf("unable to insert row: %w", err)
+	}
+
+	return nil
+}
+
+func (pg *postgres) CountByType(ctx context.Context) (map[events.Type]int, error) {
+	rows, err := pg.db.Query(ctx, `SELECT type, COUNT(*) FROM events GROUP BY type`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[events.Type]int)
+	for rows.Next() {
+		var eventType events.Type
+		var count int
+		if err := rows.Scan(&eventType, &count); err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+		counts[eventType] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (pg *postgres) Query(ctx context.Context, q Query) ([]Row, error) {
+	bucket, ok := bucketColumns[q.Bucket]
+	if !ok {
+		return nil, fmt.Errorf("unknown bucket %q", q.Bucket)
+	}
+	group, ok := groupColumns[q.GroupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown group %q", q.GroupBy)
+	}
+
+	//column expressions come from the fixed maps above
+	query := `SELECT ` + bucket + ` AS bucket, ` + group + ` AS grp, type, COUNT(*) FROM events
+	WHERE occurred_at >= $1 AND occurred_at < $2
+	GROUP BY 1, 2, 3 ORDER BY 1, 2, 3`
+
+	rows, err := pg.db.Query(ctx, query, q.From, q.To)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query: %w", err)
+	}
+	defer rows.Close()
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Row, error) {
+		var r Row
+		err := row.Scan(&r.Bucket, &r.Group, &r.Type, &r.Count)
+		return r, err
+	})
+}